@@ -1,13 +1,13 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"julo-backend/model"
 	"julo-backend/pkg/aes"
 	amqpPkg "julo-backend/pkg/amqp"
 	"julo-backend/pkg/amqpconsumer"
 	"julo-backend/pkg/env"
+	"julo-backend/pkg/interfacepkg"
 	"julo-backend/pkg/logruslogger"
 	"julo-backend/pkg/pg"
 	"julo-backend/pkg/str"
@@ -18,6 +18,7 @@ import (
 	"os"
 	"runtime"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v7"
@@ -43,6 +44,10 @@ var (
 	// if it's ever returned
 	conn      *amqpconsumer.Consumer
 	envConfig map[string]string
+
+	// Confirmed channel of the retries, guarded as it is shared by the worker goroutines
+	retryMu    sync.Mutex
+	retryQueue *amqpPkg.ConfirmQueue
 )
 
 func init() {
@@ -50,6 +55,7 @@ func init() {
 	runtime.GOMAXPROCS(*maxprocs)
 	envConfig = env.NewEnvConfig("../.env")
 	uri = flag.String("uri", envConfig["AMQP_URL"], "The rabbitmq endpoint")
+	retryQueue = &amqpPkg.ConfirmQueue{URL: envConfig["AMQP_URL"], Timeout: usecase.OutboxConfirmTimeout}
 }
 
 func main() {
@@ -121,57 +127,65 @@ func handler(deliveries <-chan amqp.Delivery, uc *usecase.ContractUC) {
 	)
 
 	for d := range deliveries {
-		var formData map[string]interface{}
-
-		err := json.Unmarshal(d.Body, &formData)
+		message, err := usecase.DecodeUpdateBalanceMessage(d.Body)
 		if err != nil {
-			log.Printf("Error unmarshaling data: %s", err.Error())
+			// A malformed message will never succeed, send it straight to the dead letter queue
+			logruslogger.Log(logruslogger.WarnLevel, err.Error()+" "+string(d.Body), ctx, "rejected", "")
+			d.Reject(false)
+			continue
 		}
 
-		uc.ReqID = formData["qid"].(string)
+		qid := message.CorrelationID
+		uc.ReqID = qid
 		time.Sleep(time.Second * time.Duration(rand))
 
 		tx := model.SQLDBTx{DB: uc.DB}
 		txFunc, err := tx.TxBegin()
-		txDB := txFunc.DB
 		if err != nil {
-			logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "rejected", formData["qid"].(string))
+			logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "rejected", qid)
 			d.Reject(false)
+			continue
 		}
-		walletUc := usecase.WalletUC{ContractUC: uc}
-		err = walletUc.AddBalance(viewmodel.SendQueue{
-			Amount:    int(formData["amount"].(float64)),
-			Type:      formData["type"].(string),
-			OwnedBy:   formData["owned_by"].(string),
-			BalanceID: formData["balance_id"].(string),
-		})
-		if err != nil {
+		txDB := txFunc.DB
+		walletUc := usecase.WalletUC{ContractUC: uc, Tx: txDB}
+		closed, processErr := walletUc.AddBalance(message.Payload)
+		if processErr == nil {
+			// A failed commit loses the operation as surely as a failed process, it is retried the same way
+			processErr = txDB.Commit()
+		}
+		if processErr != nil {
 			txDB.Rollback()
-			logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "err", formData["qid"].(string))
-
-			// Get fail counter from redis
-			failCounter := amqpconsumer.FailCounter{}
-			err = uc.GetFromRedis("amqpFail"+formData["qid"].(string), &failCounter)
-			if err != nil {
-				failCounter = amqpconsumer.FailCounter{
-					Counter: 1,
-				}
-			}
+			logruslogger.Log(logruslogger.WarnLevel, processErr.Error(), ctx, "err", qid)
 
-			if failCounter.Counter > amqpconsumer.MaxFailCounter {
-				logruslogger.Log(logruslogger.WarnLevel, strconv.Itoa(failCounter.Counter), ctx, "rejected", formData["qid"].(string))
+			// The attempt count travels with the message so retries survive a listener restart
+			attempt := amqpconsumer.Attempt(d) + 1
+			if attempt > amqpconsumer.MaxFailCounter {
+				logruslogger.Log(logruslogger.WarnLevel, strconv.Itoa(attempt), ctx, "rejected", qid)
+
+				// Persist the terminal state so clients polling the operation see an outcome
+				err = fail(uc, message, processErr.Error())
+				if err != nil {
+					logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "fail", qid)
+				}
 				d.Reject(false)
 			} else {
-				// Save the new counter to redis
-				failCounter.Counter++
-				err = uc.StoreToRedisExp("amqpFail"+formData["qid"].(string), failCounter, "10m")
+				err = retry(message, attempt)
+				if err != nil {
+					// Could not schedule the retry, fall back to an immediate requeue
+					logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "retry", qid)
+					d.Nack(false, true)
+					continue
+				}
 
-				logruslogger.Log(logruslogger.WarnLevel, strconv.Itoa(failCounter.Counter), ctx, "failed", formData["qid"].(string))
-				d.Nack(false, true)
+				logruslogger.Log(logruslogger.WarnLevel, strconv.Itoa(attempt), ctx, "failed", qid)
+				d.Ack(false)
 			}
 		} else {
-			txDB.Commit()
-			logruslogger.Log(logruslogger.InfoLevel, string(d.Body), ctx, "success", formData["qid"].(string))
+			// The sessions of a wallet closed with its payout end only once the closure is committed
+			if closed {
+				usecase.WalletUC{ContractUC: uc}.RevokeSessions(uc.OwnerIndex(message.Payload))
+			}
+			logruslogger.Log(logruslogger.InfoLevel, string(d.Body), ctx, "success", qid)
 			d.Ack(false)
 		}
 	}
@@ -179,6 +193,41 @@ func handler(deliveries <-chan amqp.Delivery, uc *usecase.ContractUC) {
 	return
 }
 
+// fail the operation in its own transaction, the closure of a failed payout is cancelled and audited with it
+func fail(uc *usecase.ContractUC, message viewmodel.QueueEnvelope, reason string) (err error) {
+	tx := model.SQLDBTx{DB: uc.DB}
+	txFunc, err := tx.TxBegin()
+	if err != nil {
+		return err
+	}
+
+	txDB := txFunc.DB
+	err = usecase.WalletUC{ContractUC: uc, Tx: txDB}.FailBalance(message.Payload, reason)
+	if err != nil {
+		txDB.Rollback()
+		return err
+	}
+
+	return txDB.Commit()
+}
+
+// retry republish the message to the delay queue of its attempt, the delay doubles on every attempt
+func retry(message viewmodel.QueueEnvelope, attempt int) (err error) {
+	ttl := amqpconsumer.RetryDelay(attempt)
+	headers := amqp.Table{
+		amqpconsumer.AttemptHeader: int32(attempt),
+	}
+
+	// The original is only acked once the broker confirmed the retry, so a lost publish is redelivered
+	retryMu.Lock()
+	defer retryMu.Unlock()
+
+	return retryQueue.PushQueueDelayReconnect(
+		interfacepkg.UnmarshallMap(interfacepkg.Marshall(message)), headers,
+		amqpPkg.UpdateBalanceDelay+"."+strconv.FormatInt(ttl, 10), amqpPkg.UpdateBalance, amqpPkg.UpdateBalanceDeadLetter, ttl,
+	)
+}
+
 func handleError(err error, msg string) {
 	if err != nil {
 		log.Fatalf("%s: %s", msg, err)
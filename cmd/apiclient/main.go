@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"julo-backend/pkg/aes"
+	"julo-backend/pkg/env"
+	"julo-backend/pkg/pg"
+	"julo-backend/pkg/str"
+	"julo-backend/usecase"
+	"log"
+	"os"
+	"strings"
+)
+
+// Manage the api clients calling /init and /sessions/revoke. Every operator of the admin
+// api has a client created with -scopes=admin, its name is the operator recorded in the audit.
+//
+//	go run main.go create  -name=<name> [-scopes=wallet:init,sessions:revoke]
+//	go run main.go rotate  -client_id=<client_id>
+//	go run main.go disable -client_id=<client_id>
+//	go run main.go enable  -client_id=<client_id>
+//	go run main.go list
+//
+// create and rotate print the secret once. Clients send it with HTTP Basic as
+// client_id:client_secret and sign their requests with it, see pkg/signature.
+// Clients created before request signing must rotate their secret to sign.
+var (
+	actions  = []string{"create", "rotate", "disable", "enable", "list"}
+	flags    = flag.NewFlagSet("apiclient", flag.ExitOnError)
+	name     = flags.String("name", "", "Name of the client")
+	scopes   = flags.String("scopes", strings.Join(usecase.DefaultClientScopes, ","), "Comma separated scopes of the client")
+	clientID = flags.String("client_id", "", "Client id")
+	envFile  = flags.String("env", "../../.env", "Location of the env file")
+)
+
+func main() {
+	if len(os.Args) < 2 || !str.Contains(actions, os.Args[1]) {
+		fmt.Println("usage: apiclient create|rotate|disable|enable|list [flags]")
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	action := os.Args[1]
+	flags.Parse(os.Args[2:])
+	envConfig := env.NewEnvConfig(*envFile)
+
+	dbInfo := pg.Connection{
+		Host:    envConfig["DATABASE_HOST"],
+		DB:      envConfig["DATABASE_DB"],
+		User:    envConfig["DATABASE_USER"],
+		Pass:    envConfig["DATABASE_PASSWORD"],
+		Port:    str.StringToInt(envConfig["DATABASE_PORT"]),
+		SslMode: envConfig["DATABASE_SSL_MODE"],
+	}
+	db, err := dbInfo.Connect()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer db.Close()
+
+	uc := usecase.ApiClientUC{ContractUC: &usecase.ContractUC{
+		DB:        db,
+		EnvConfig: envConfig,
+		Aes:       aes.Credential{Key: envConfig["AES_KEY"]},
+	}}
+	switch action {
+	case "create":
+		if *name == "" {
+			log.Fatal("Error: -name is required")
+		}
+		res, err := uc.Create(*name, strings.Split(*scopes, ","))
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		fmt.Printf("client_id:     %s\nclient_secret: %s\n", res.ClientID, res.ClientSecret)
+	case "rotate":
+		res, err := uc.RotateSecret(required(*clientID))
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		fmt.Printf("client_id:     %s\nclient_secret: %s\n", res.ClientID, res.ClientSecret)
+	case "disable", "enable":
+		if err := uc.SetEnabled(required(*clientID), action == "enable"); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		log.Printf("%s is %sd", *clientID, action)
+	case "list":
+		res, err := uc.FindAll()
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		for _, client := range res {
+			fmt.Printf("%s\t%s\t%s\t%t\t%s\n", client.ClientID, client.Name, strings.Join(client.Scopes, ","), client.Enabled, client.CreatedAt)
+		}
+	}
+}
+
+func required(clientID string) string {
+	if clientID == "" {
+		log.Fatal("Error: -client_id is required")
+	}
+
+	return clientID
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"julo-backend/pkg/env"
+	"julo-backend/pkg/pg"
+	"julo-backend/pkg/str"
+	"julo-backend/usecase"
+	"log"
+)
+
+// Walk every audit chain from its first event to its head and recompute every hash.
+//
+//	go run main.go [-batch=1000]
+//
+// Exits with the seq of the first event that was modified, removed or reordered, or of the head of
+// a chain whose latest events were removed.
+var (
+	batch   = flag.Int("batch", 1000, "Number of events read at once")
+	envFile = flag.String("env", "../../.env", "Location of the env file")
+)
+
+func main() {
+	flag.Parse()
+	envConfig := env.NewEnvConfig(*envFile)
+
+	dbInfo := pg.Connection{
+		Host:    envConfig["DATABASE_HOST"],
+		DB:      envConfig["DATABASE_DB"],
+		User:    envConfig["DATABASE_USER"],
+		Pass:    envConfig["DATABASE_PASSWORD"],
+		Port:    str.StringToInt(envConfig["DATABASE_PORT"]),
+		SslMode: envConfig["DATABASE_SSL_MODE"],
+	}
+	db, err := dbInfo.Connect()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer db.Close()
+
+	uc := usecase.AuditUC{ContractUC: &usecase.ContractUC{DB: db, EnvConfig: envConfig}}
+	res, err := uc.Verify(*batch)
+	if err != nil {
+		if res.BrokenAt > 0 {
+			log.Fatalf("Error: %v at seq %d, %d events verified before it", err, res.BrokenAt, res.Count)
+		}
+		log.Fatalf("Error: %v", err)
+	}
+	fmt.Printf("events:   %d\nchains:   %d\nlast_seq: %d\n", res.Count, res.Chains, res.LastSeq)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"julo-backend/pkg/aes"
+	"julo-backend/pkg/amqp"
+	"julo-backend/pkg/amqpconsumer"
+	"julo-backend/pkg/env"
+	"julo-backend/pkg/pg"
+	"julo-backend/pkg/str"
+	"julo-backend/usecase"
+	"julo-backend/usecase/viewmodel"
+	"log"
+	"os"
+
+	streadway "github.com/streadway/amqp"
+)
+
+// Inspect the update balance dead letter queue.
+//
+//	go run main.go list    [-owned_by=<id>] [-balance_id=<id>] [-limit=100]
+//	go run main.go show    [-owned_by=<id>] [-balance_id=<id>]
+//	go run main.go replay  [-owned_by=<id>] [-balance_id=<id>]
+//	go run main.go discard [-owned_by=<id>] [-balance_id=<id>]
+//
+// replay moves the matching balance rows from failed back to pending and
+// writes the messages to the outbox, discard drops them for good. Messages carry the
+// blind index of the customer, -owned_by takes the customer id and matches its index.
+var (
+	actions   = []string{"list", "show", "replay", "discard"}
+	flags     = flag.NewFlagSet("dlq", flag.ExitOnError)
+	ownedBy   = flags.String("owned_by", "", "Only messages of this customer id")
+	balanceID = flags.String("balance_id", "", "Only messages of this balance")
+	limit     = flags.Int("limit", 100, "The max amount of messages to browse")
+	queue     = flags.String("queue", amqp.UpdateBalanceDeadLetter, "Dead letter queue to inspect")
+	envFile   = flags.String("env", "../../.env", "Location of the env file")
+
+	envConfig map[string]string
+)
+
+func main() {
+	if len(os.Args) < 2 || !str.Contains(actions, os.Args[1]) {
+		fmt.Println("usage: dlq list|show|replay|discard [flags]")
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	action := os.Args[1]
+	flags.Parse(os.Args[2:])
+	envConfig = env.NewEnvConfig(*envFile)
+
+	conn := amqpconsumer.NewConsumer("dlq.cli", envConfig["AMQP_URL"], amqp.UpdateBalanceExchange, "direct", *queue)
+	if err := conn.Connect(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	uc := usecase.ContractUC{EnvConfig: envConfig, Aes: aes.Credential{Key: envConfig["AES_KEY"]}}
+	if action == "replay" {
+		dbInfo := pg.Connection{
+			Host:    envConfig["DATABASE_HOST"],
+			DB:      envConfig["DATABASE_DB"],
+			User:    envConfig["DATABASE_USER"],
+			Pass:    envConfig["DATABASE_PASSWORD"],
+			Port:    str.StringToInt(envConfig["DATABASE_PORT"]),
+			SslMode: envConfig["DATABASE_SSL_MODE"],
+		}
+		db, err := dbInfo.Connect()
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer db.Close()
+		uc.DB = db
+	}
+
+	count := 0
+	err := conn.Browse(*queue, *limit, func(d streadway.Delivery) (bool, error) {
+		message, decodeErr := usecase.DecodeUpdateBalanceMessage(d.Body)
+		if !match(&uc, message.Payload) {
+			return false, nil
+		}
+		count++
+
+		switch action {
+		case "list":
+			fmt.Printf("%s\t%s\t%s\t%d\t%s\n",
+				message.Payload.BalanceID, uc.OwnerIndex(message.Payload), message.Payload.Type,
+				message.Payload.Amount, message.CorrelationID,
+			)
+		case "show":
+			body := map[string]interface{}{
+				"headers": d.Headers,
+				"message": message,
+			}
+			if decodeErr != nil {
+				body["error"] = decodeErr.Error()
+				body["raw"] = string(d.Body)
+			}
+			out, _ := json.MarshalIndent(body, "", "  ")
+			fmt.Println(string(out))
+		case "replay":
+			if decodeErr != nil {
+				return false, decodeErr
+			}
+			return true, replay(&uc, d, message)
+		case "discard":
+			fmt.Println("discarded", message.Payload.BalanceID)
+			return true, d.Ack(false)
+		}
+
+		return false, nil
+	})
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	log.Printf("%d message(s) %s", count, action)
+}
+
+// match check the message against the owned_by and balance_id filters
+func match(uc *usecase.ContractUC, payload viewmodel.SendQueue) bool {
+	if *ownedBy != "" && uc.OwnerIndex(payload) != uc.CustomerIndex(*ownedBy) {
+		return false
+	}
+	if *balanceID != "" && payload.BalanceID != *balanceID {
+		return false
+	}
+
+	return true
+}
+
+// replay reopen the failed balance row and write the message to the outbox in the same transaction,
+// the message is only acked once committed so a failure leaves it in the dead letter queue. The relay
+// of the api server publishes it to the incoming queue.
+func replay(uc *usecase.ContractUC, d streadway.Delivery, message viewmodel.QueueEnvelope) (err error) {
+	balanceUc := usecase.BalanceUC{ContractUC: uc}
+	err = balanceUc.Replay(message)
+	if err != nil {
+		d.Nack(false, true)
+		return err
+	}
+	fmt.Println("replayed", message.Payload.BalanceID)
+
+	return d.Ack(false)
+}
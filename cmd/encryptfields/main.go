@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"julo-backend/model"
+	"julo-backend/pkg/aes"
+	"julo-backend/pkg/env"
+	"julo-backend/pkg/pg"
+	"julo-backend/pkg/str"
+	"julo-backend/usecase"
+	"log"
+)
+
+// Encrypt the customer ids stored in plain and re-encrypt the values of an older ciphertext version.
+//
+//	go run main.go [-batch=500]
+//
+// Run it once the schema is migrated and again after the new version is deployed, rows written
+// in between by the previous version are still plain. It is safe to run it repeatedly.
+// A wallet looked up before its row is migrated is encrypted by the api itself and skipped here.
+var (
+	batch   = flag.Int("batch", 500, "Rows migrated per transaction")
+	envFile = flag.String("env", "../../.env", "Location of the env file")
+)
+
+func main() {
+	flag.Parse()
+	envConfig := env.NewEnvConfig(*envFile)
+
+	dbInfo := pg.Connection{
+		Host:    envConfig["DATABASE_HOST"],
+		DB:      envConfig["DATABASE_DB"],
+		User:    envConfig["DATABASE_USER"],
+		Pass:    envConfig["DATABASE_PASSWORD"],
+		Port:    str.StringToInt(envConfig["DATABASE_PORT"]),
+		SslMode: envConfig["DATABASE_SSL_MODE"],
+	}
+	db, err := dbInfo.Connect()
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer db.Close()
+
+	uc := usecase.EncryptionUC{ContractUC: &usecase.ContractUC{
+		DB:        db,
+		EnvConfig: envConfig,
+		Aes:       aes.Credential{Key: envConfig["AES_KEY"]},
+	}}
+	for _, column := range model.EncryptedColumns {
+		count, err := uc.Migrate(column, *batch)
+		if err != nil {
+			log.Fatalf("Error: %s.%s after %d rows: %v", column.Table, column.Column, count, err)
+		}
+		log.Printf("%s.%s: %d rows migrated", column.Table, column.Column, count)
+	}
+}
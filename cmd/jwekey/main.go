@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"julo-backend/pkg/env"
+	"julo-backend/pkg/jwe"
+	"julo-backend/pkg/str"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Manage the JWE keyring manifest.
+//
+//	go run main.go init     -file=<existing key>
+//	go run main.go generate [-type=rsa|ec] [-bits=4096]
+//	go run main.go rotate   [-kid=<kid>] [-type=rsa|ec]
+//	go run main.go retire   -kid=<kid>
+//	go run main.go list
+//
+// A rotation is done in two steps so every instance can decrypt with the new key
+// before it is used to encrypt: generate a key on every instance (status decrypt),
+// restart, then rotate to it. The previous active key keeps decrypting until the
+// tokens it issued expired, then retire it. rotate without a kid generates and
+// activates a new key at once.
+//
+// The same tool manages the token signing keyring with -keyring=../../key/signing.json,
+// RS256 needs rsa keys and ES256 ec keys. Use ec keys for JWE with ECDH-ES.
+var (
+	actions   = []string{"init", "generate", "rotate", "retire", "list"}
+	flags     = flag.NewFlagSet("jwekey", flag.ExitOnError)
+	keyring   = flags.String("keyring", "../../key/keyring.json", "Location of the keyring manifest")
+	kid       = flags.String("kid", "", "Key id")
+	file      = flags.String("file", "", "Existing private key imported by init")
+	keyType   = flags.String("type", jwe.KeyTypeRSA, "Type of the generated key, rsa or ec")
+	bits      = flags.Int("bits", 4096, "Size of the generated RSA key")
+	envFile   = flags.String("env", "../../.env", "Location of the env file")
+	envConfig map[string]string
+)
+
+func main() {
+	if len(os.Args) < 2 || !str.Contains(actions, os.Args[1]) {
+		fmt.Println("usage: jwekey init|generate|rotate|retire|list [flags]")
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	action := os.Args[1]
+	flags.Parse(os.Args[2:])
+	envConfig = env.NewEnvConfig(*envFile)
+
+	if action == "init" {
+		initKeyring()
+		return
+	}
+
+	// A new keyring starts empty, the first rotate makes its key active
+	manifest := jwe.Manifest{Keys: []jwe.KeyEntry{}}
+	_, err := os.Stat(*keyring)
+	if err == nil || action != "rotate" {
+		manifest, err = jwe.ReadManifest(*keyring)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+
+	switch action {
+	case "generate":
+		entry := generate(&manifest, jwe.StatusDecrypt)
+		log.Printf("generated %s, restart every instance before rotating to it", entry.ID)
+	case "rotate":
+		if *kid == "" {
+			*kid = generate(&manifest, jwe.StatusDecrypt).ID
+		}
+		rotate(&manifest, *kid)
+		log.Printf("%s is now the active key", *kid)
+	case "retire":
+		retire(&manifest, *kid)
+		log.Printf("%s is retired", *kid)
+	case "list":
+		for _, entry := range manifest.Keys {
+			fmt.Printf("%s\t%s\t%s\t%s\n", entry.ID, entry.Status, entry.CreatedAt, entry.File)
+		}
+		return
+	}
+
+	if err = jwe.WriteManifest(*keyring, manifest); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+// initKeyring create a manifest with the existing single key as the active key,
+// tokens issued before the keyring carry no kid and are still decrypted with it
+func initKeyring() {
+	if _, err := os.Stat(*keyring); err == nil {
+		log.Fatalf("Error: %s already exists", *keyring)
+	}
+	if *file == "" {
+		log.Fatal("Error: -file is required")
+	}
+
+	ring, err := jwe.LoadKeyring(*file, envConfig["APP_PRIVATE_KEY_PASSPHRASE"])
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	dir, _ := filepath.Abs(filepath.Dir(*keyring))
+	location, _ := filepath.Abs(*file)
+	rel, err := filepath.Rel(dir, location)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	manifest := jwe.Manifest{Keys: []jwe.KeyEntry{{
+		ID:        ring.Active().ID,
+		File:      rel,
+		Status:    jwe.StatusActive,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}}}
+	if err = jwe.WriteManifest(*keyring, manifest); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Printf("created %s with active key %s", *keyring, ring.Active().ID)
+}
+
+// generate write a new key next to the manifest and add it with the given status
+func generate(manifest *jwe.Manifest, status string) jwe.KeyEntry {
+	var key crypto.Signer
+	switch *keyType {
+	case jwe.KeyTypeRSA:
+		rsaKey, err := jwe.GenRSA(*bits)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		key = rsaKey
+	case jwe.KeyTypeEC:
+		ecKey, err := jwe.GenEC()
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		key = ecKey
+	default:
+		log.Fatalf("Error: unknown key type %s", *keyType)
+	}
+	pem, err := jwe.EncodeKey(key, envConfig["APP_PRIVATE_KEY_PASSPHRASE"])
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	entry := jwe.KeyEntry{
+		ID:        jwe.Thumbprint(key),
+		File:      jwe.Thumbprint(key) + ".pem",
+		Status:    status,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	err = ioutil.WriteFile(filepath.Join(filepath.Dir(*keyring), entry.File), pem, 0600)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	manifest.Keys = append(manifest.Keys, entry)
+
+	return entry
+}
+
+// rotate make the key active, the previous active key is kept to decrypt
+func rotate(manifest *jwe.Manifest, id string) {
+	index := find(manifest, id)
+	if manifest.Keys[index].Status == jwe.StatusRetired {
+		log.Fatalf("Error: %s is retired", id)
+	}
+
+	for i := range manifest.Keys {
+		if manifest.Keys[i].Status == jwe.StatusActive {
+			manifest.Keys[i].Status = jwe.StatusDecrypt
+		}
+	}
+	manifest.Keys[index].Status = jwe.StatusActive
+}
+
+// retire stop accepting tokens encrypted with the key
+func retire(manifest *jwe.Manifest, id string) {
+	index := find(manifest, id)
+	if manifest.Keys[index].Status == jwe.StatusActive {
+		log.Fatalf("Error: %s is the active key, rotate first", id)
+	}
+	manifest.Keys[index].Status = jwe.StatusRetired
+}
+
+func find(manifest *jwe.Manifest, id string) int {
+	if id == "" {
+		log.Fatal("Error: -kid is required")
+	}
+	for i, entry := range manifest.Keys {
+		if entry.ID == id {
+			return i
+		}
+	}
+	log.Fatalf("Error: %s is not in the keyring", id)
+
+	return -1
+}
@@ -19,4 +19,258 @@ create table balance (
 	deposited_at TIMESTAMP WITH TIME ZONE,
 	withdrawn_by uuid,
 	withdrawn_at TIMESTAMP WITH TIME ZONE
-);
\ No newline at end of file
+);
+create index balance_deposited_by_idx on balance (deposited_by, deposited_at DESC, id DESC);
+create index balance_withdrawn_by_idx on balance (withdrawn_by, withdrawn_at DESC, id DESC);
+
+create table ledger_account (
+	id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+	code TEXT NOT NULL UNIQUE,
+	type TEXT NOT NULL CHECK (type IN ('wallet', 'system')),
+	wallet_id uuid REFERENCES wallet (id),
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+create table journal_entry (
+	id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+	balance_id uuid REFERENCES balance (id),
+	type TEXT NOT NULL CHECK (char_length(type) <= 20),
+	description TEXT,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+create table journal_line (
+	id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+	journal_entry_id uuid NOT NULL REFERENCES journal_entry (id),
+	account_id uuid NOT NULL REFERENCES ledger_account (id),
+	debit integer NOT NULL DEFAULT 0 CHECK (debit >= 0),
+	credit integer NOT NULL DEFAULT 0 CHECK (credit >= 0),
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	CHECK ((debit = 0) <> (credit = 0))
+);
+
+create index journal_line_account_id_idx on journal_line (account_id);
+
+insert into ledger_account (code, type) values
+	('system:deposit', 'system'),
+	('system:withdrawal', 'system'),
+	('system:opening', 'system');
+
+-- open a ledger account for every existing wallet and post its current balance as an opening journal
+insert into ledger_account (code, type, wallet_id)
+	select 'wallet:' || id, 'wallet', id from wallet
+	on conflict (code) do nothing;
+
+with opening as (
+	insert into journal_entry (type, description)
+		select 'opening', 'wallet:' || id from wallet where balance > 0
+		returning id, description
+)
+insert into journal_line (journal_entry_id, account_id, debit, credit)
+	select o.id, s.id, w.balance, 0
+		from opening o
+		join wallet w on 'wallet:' || w.id = o.description
+		cross join ledger_account s
+		where s.code = 'system:opening'
+	union all
+	select o.id, a.id, 0, w.balance
+		from opening o
+		join wallet w on 'wallet:' || w.id = o.description
+		join ledger_account a on a.code = o.description;
+
+create table transfer (
+	id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+	amount integer NOT NULL CHECK (amount > 0),
+	status TEXT NOT NULL CHECK (char_length(status) <= 20),
+	reference_id uuid NOT NULL UNIQUE,
+	transferred_by uuid NOT NULL,
+	received_by uuid NOT NULL,
+	transferred_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+alter table journal_entry add column transfer_id uuid REFERENCES transfer (id);
+
+alter table balance add column failure_reason TEXT;
+alter table wallet add constraint wallet_balance_non_negative CHECK (balance >= 0);
+
+alter table balance add constraint balance_status_valid CHECK (status IN ('pending', 'success', 'failed', 'reversed'));
+
+create index balance_reference_id_idx on balance (reference_id);
+
+create table outbox (
+	id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+	queue TEXT NOT NULL,
+	dead_letter_queue TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	status TEXT NOT NULL CHECK (status IN ('pending', 'sent')),
+	attempts integer NOT NULL DEFAULT 0,
+	last_error TEXT,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	sent_at TIMESTAMP WITH TIME ZONE
+);
+
+create index outbox_pending_idx on outbox (created_at) WHERE status = 'pending';
+
+-- a balance operation is posted to the ledger at most once
+create unique index journal_entry_balance_id_idx on journal_entry (balance_id) WHERE balance_id IS NOT NULL;
+
+-- customer ids are stored encrypted and looked up through a blind index,
+-- existing rows are migrated with cmd/encryptfields
+alter table wallet alter column owned_by type TEXT;
+alter table wallet add column owned_by_index TEXT;
+create unique index wallet_owned_by_index_idx on wallet (owned_by_index);
+
+alter table balance alter column deposited_by type TEXT, alter column withdrawn_by type TEXT;
+alter table balance add column deposited_by_index TEXT, add column withdrawn_by_index TEXT;
+drop index balance_deposited_by_idx;
+drop index balance_withdrawn_by_idx;
+create index balance_deposited_by_index_idx on balance (deposited_by_index, deposited_at DESC, id DESC);
+create index balance_withdrawn_by_index_idx on balance (withdrawn_by_index, withdrawn_at DESC, id DESC);
+
+alter table transfer alter column transferred_by type TEXT, alter column received_by type TEXT;
+
+-- clients calling /init and /sessions/revoke authenticate with HTTP Basic, managed with cmd/apiclient
+create table api_client (
+	id uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+	client_id TEXT NOT NULL UNIQUE,
+	name TEXT NOT NULL,
+	secret_hash TEXT NOT NULL,
+	scopes TEXT[] NOT NULL DEFAULT '{}',
+	enabled boolean NOT NULL DEFAULT true,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	disabled_at TIMESTAMP WITH TIME ZONE
+);
+
+alter table wallet add column created_by_client TEXT;
+
+-- the secret encrypted with AES_KEY to verify the request signatures, set by cmd/apiclient create and rotate
+alter table api_client add column signing_secret TEXT;
+
+-- the api clients issue the wallet token scopes they were granted, existing clients keep issuing every scope
+update api_client set scopes = scopes || '{wallet:read,wallet:deposit,wallet:withdraw,wallet:manage}'::TEXT[];
+
+-- append-only audit chain of the wallet changes, verified with cmd/auditverify
+create table audit_event (
+	seq bigserial PRIMARY KEY,
+	actor TEXT NOT NULL,
+	action TEXT NOT NULL,
+	wallet_id uuid,
+	before TEXT,
+	after TEXT,
+	reason TEXT,
+	request_id TEXT,
+	ip TEXT,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	prev_hash TEXT NOT NULL,
+	hash TEXT NOT NULL
+);
+create index audit_event_wallet_id_idx on audit_event (wallet_id, seq DESC);
+create index audit_event_actor_idx on audit_event (actor, seq DESC);
+
+create function audit_event_append_only() returns trigger as $$
+begin
+	raise exception 'audit_event is append-only';
+end;
+$$ language plpgsql;
+create trigger audit_event_append_only before update or delete on audit_event
+	for each row execute procedure audit_event_append_only();
+create trigger audit_event_no_truncate before truncate on audit_event
+	for each statement execute procedure audit_event_append_only();
+
+-- operators freeze a wallet with a reason and an optional expiry, frozen_from is the status restored when it expires
+alter table wallet add column frozen_at TIMESTAMP WITH TIME ZONE, add column frozen_reason TEXT,
+	add column frozen_until TIMESTAMP WITH TIME ZONE, add column frozen_accepts_deposit boolean NOT NULL DEFAULT false,
+	add column frozen_from TEXT;
+
+-- closed is terminal, the wallet and its history are kept until retain_until (WALLET_RETENTION_YEARS after the closure)
+alter table wallet add column closed_at TIMESTAMP WITH TIME ZONE, add column closed_reason TEXT,
+	add column retain_until TIMESTAMP WITH TIME ZONE;
+-- where the payout of a closed wallet was sent
+alter table balance add column destination TEXT;
+
+-- only closed wallets are retained, a closed wallet without retain_until is kept for good
+create function wallet_retained() returns trigger as $$
+begin
+	if old.status = 'closed' and (old.retain_until is null or old.retain_until > now()) then
+		raise exception 'wallet % is retained', old.id;
+	end if;
+	return old;
+end;
+$$ language plpgsql;
+create trigger wallet_retained before delete on wallet
+	for each row execute procedure wallet_retained();
+
+create function balance_retained() returns trigger as $$
+begin
+	if exists (
+		select 1 from wallet where owned_by_index = coalesce(old.deposited_by_index, old.withdrawn_by_index)
+			and status = 'closed' and (retain_until is null or retain_until > now())
+	) then
+		raise exception 'balance % is retained', old.id;
+	end if;
+	return old;
+end;
+$$ language plpgsql;
+create trigger balance_retained before delete on balance
+	for each row execute procedure balance_retained();
+
+-- transfers are part of the transaction history of both customers,
+-- existing rows get their blind index from cmd/encryptfields
+alter table transfer add column transferred_by_index TEXT, add column received_by_index TEXT;
+create index transfer_transferred_by_index_idx on transfer (transferred_by_index, transferred_at DESC, id DESC);
+create index transfer_received_by_index_idx on transfer (received_by_index, transferred_at DESC, id DESC);
+
+-- the relay claims outbox messages for a while instead of holding their locks while it publishes
+alter table outbox add column claimed_until TIMESTAMP WITH TIME ZONE;
+
+-- a wallet closing with a balance waits for its payout withdrawal, it is closed once the payout succeeds
+alter table wallet add column closing_payout_id uuid, add column closing_reason TEXT;
+
+-- the audit chain is kept per wallet instead of behind a global lock, the events of no wallet form the system
+-- chain. The events recorded before have no chain and are verified as the legacy single chain
+alter table audit_event add column chain TEXT;
+create index audit_event_chain_idx on audit_event (chain, seq);
+-- the latest event of every chain, an event removed from the end of a chain no longer matches it
+create table audit_head (
+	chain TEXT PRIMARY KEY,
+	seq bigint NOT NULL,
+	hash TEXT NOT NULL
+);
+
+-- operator reads of the admin api, they are not chained so they never wait on the chain of a wallet
+create table audit_access (
+	seq bigserial PRIMARY KEY,
+	actor TEXT NOT NULL,
+	action TEXT NOT NULL,
+	wallet_id uuid,
+	detail TEXT,
+	request_id TEXT,
+	ip TEXT,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+create index audit_access_actor_idx on audit_access (actor, seq DESC);
+
+create function audit_access_append_only() returns trigger as $$
+begin
+	raise exception 'audit_access is append-only';
+end;
+$$ language plpgsql;
+create trigger audit_access_append_only before update or delete on audit_access
+	for each row execute procedure audit_access_append_only();
+create trigger audit_access_no_truncate before truncate on audit_access
+	for each statement execute procedure audit_access_append_only();
+
+-- a reference is used by a single deposit or withdrawal, the check before the insert does not hold under
+-- concurrent requests. Duplicates stored before must be resolved before creating the index
+drop index balance_reference_id_idx;
+create unique index balance_reference_id_idx on balance (reference_id);
+
+-- the ledger account of a wallet is opened with the wallet and keeps its running balance, reading the balance
+-- no longer sums the journal lines. Accounts of the wallets which were never posted are opened here
+insert into ledger_account (code, type, wallet_id)
+	select 'wallet:' || id, 'wallet', id from wallet
+	on conflict (code) do nothing;
+alter table ledger_account add column balance bigint NOT NULL DEFAULT 0;
+update ledger_account a set balance = l.balance
+	from (select account_id, sum(credit) - sum(debit) as balance from journal_line group by account_id) l
+	where l.account_id = a.id and a.type = 'wallet';
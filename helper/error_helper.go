@@ -17,9 +17,79 @@ var (
 	AlreadyEnabled = "Already enabled"
 	// Disabled ...
 	Disabled = "Disabled"
+	// InvalidCursor ...
+	InvalidCursor = "Invalid cursor"
+	// InvalidDate ...
+	InvalidDate = "Invalid date"
+	// InvalidSort ...
+	InvalidSort = "Invalid sort"
+	// InvalidStatus ...
+	InvalidStatus = "Invalid status"
+	// BalanceNotFound ...
+	BalanceNotFound = "Balance not found"
+	// InvalidID ...
+	InvalidID = "Invalid id"
+	// InvalidType ...
+	InvalidType = "Invalid type"
+	// UnbalancedJournal ...
+	UnbalancedJournal = "Unbalanced journal"
+	// WalletNotFound ...
+	WalletNotFound = "Wallet not found"
+	// ReceiverNotFound ...
+	ReceiverNotFound = "Receiver wallet not found"
+	// ReceiverDisabled ...
+	ReceiverDisabled = "Receiver wallet disabled"
+	// ReceiverFrozen ...
+	ReceiverFrozen = "Receiver wallet frozen"
+	// Frozen ...
+	Frozen = "Wallet frozen"
+	// Closed ...
+	Closed = "Wallet closed"
+	// BalanceNotZero ...
+	BalanceNotZero = "Balance not zero, a destination is required for the payout"
+	// PendingOperations ...
+	PendingOperations = "Wallet has pending operations"
+	// Closing ...
+	Closing = "Wallet closing, waiting for the payout"
+	// InvalidDestination ...
+	InvalidDestination = "Invalid payout destination"
+	// InvalidTransition ...
+	InvalidTransition = "Invalid status transition"
+	// TransferToSelf ...
+	TransferToSelf = "Cannot transfer to own wallet"
+	// InvalidMessage ...
+	InvalidMessage = "Invalid message"
+	// InvalidRefreshToken ...
+	InvalidRefreshToken = "Invalid refresh token"
+	// RefreshTokenReused ...
+	RefreshTokenReused = "Refresh token reused, session revoked"
+	// ExpiredSession ...
+	ExpiredSession = "Expired session"
+	// SessionNotFound ...
+	SessionNotFound = "Session not found"
+	// LedgerAccountNotFound ...
+	LedgerAccountNotFound = "Ledger account not found"
+	// InvalidClient ...
+	InvalidClient = "Invalid client credentials"
+	// ClientNotFound ...
+	ClientNotFound = "Client not found"
+	// InvalidScope ...
+	InvalidScope = "Invalid scope"
+	// InvalidSignature ...
+	InvalidSignature = "Invalid signature"
+	// ExpiredSignature ...
+	ExpiredSignature = "Expired signature"
+	// ReplayedRequest ...
+	ReplayedRequest = "Replayed request"
+	// AuditChainBroken ...
+	AuditChainBroken = "Audit chain broken"
+	// InsufficientScope ...
+	InsufficientScope = "Insufficient scope"
 )
 
 const (
 	// Token ...
 	Token = "token"
+	// Client ...
+	Client = "client"
 )
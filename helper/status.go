@@ -3,8 +3,52 @@ package helper
 var (
 	StatusEnabled  = "enabled"
 	StatusDisabled = "disabled"
+	StatusFrozen   = "frozen"
+	StatusClosed   = "closed"
 	StatusPending  = "pending"
 	StatusSuccess  = "success"
+	StatusFailed   = "failed"
+	StatusReversed = "reversed"
+	StatusSent     = "sent"
 	TypeWithdrawal = "withdrawal"
 	TypeDeposit    = "deposit"
+	TypeTransfer   = "transfer"
+
+	LedgerAccountTypeWallet = "wallet"
+	LedgerAccountTypeSystem = "system"
+	LedgerAccountDeposit    = "system:deposit"
+	LedgerAccountWithdrawal = "system:withdrawal"
+	LedgerAccountWallet     = "wallet:"
+
+	// scopes granted to the api clients
+	ScopeWalletInit    = "wallet:init"
+	ScopeSessionRevoke = "sessions:revoke"
+	ScopeAdmin         = "admin"
+
+	// scopes of the wallet tokens, an api client can only issue the ones it was granted
+	ScopeWalletRead     = "wallet:read"
+	ScopeWalletDeposit  = "wallet:deposit"
+	ScopeWalletWithdraw = "wallet:withdraw"
+	ScopeWalletManage   = "wallet:manage"
+
+	RoleAdmin = "admin"
+
+	// actions of the audit chain
+	AuditActorSystem       = "system"
+	AuditWalletCreate      = "wallet.create"
+	AuditWalletStatus      = "wallet.status"
+	AuditWalletClose       = "wallet.close"
+	AuditDepositRequest    = "deposit.request"
+	AuditWithdrawalRequest = "withdrawal.request"
+	AuditBalancePosted     = "balance.posted"
+	AuditBalanceFailed     = "balance.failed"
+	AuditTransferOut       = "transfer.out"
+	AuditTransferIn        = "transfer.in"
+	// operator reads and actions of the admin api
+	AuditAdminToken     = "admin.token"
+	AuditWalletSearch   = "wallet.search"
+	AuditWalletView     = "wallet.view"
+	AuditPendingView    = "operation.pending"
+	AuditSearch         = "audit.search"
+	AuditSessionsRevoke = "sessions.revoke"
 )
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"database/sql"
+	"julo-backend/helper"
+
+	"github.com/lib/pq"
+)
+
+// apiClientModel ...
+type apiClientModel struct {
+	DB *sql.DB
+	Tx *sql.Tx
+}
+
+// IApiClient ...
+type IApiClient interface {
+	FindByClientID(clientID string) (ApiClientEntity, error)
+	FindAll() ([]ApiClientEntity, error)
+	Store(body ApiClientEntity) (string, error)
+	UpdateSecret(clientID, secretHash, signingSecret string) (string, error)
+	UpdateEnabled(clientID string, enabled bool) (string, error)
+}
+
+// ApiClientEntity the secret is stored hashed to authenticate and encrypted to verify the request signatures
+type ApiClientEntity struct {
+	ID            string         `db:"id"`
+	ClientID      string         `db:"client_id"`
+	Name          string         `db:"name"`
+	SecretHash    string         `db:"secret_hash"`
+	SigningSecret sql.NullString `db:"signing_secret"`
+	Scopes        []string       `db:"scopes"`
+	Enabled       bool           `db:"enabled"`
+	CreatedAt     string         `db:"created_at"`
+	DisabledAt    sql.NullString `db:"disabled_at"`
+}
+
+// NewApiClientModel ...
+func NewApiClientModel(db *sql.DB, tx *sql.Tx) IApiClient {
+	return &apiClientModel{DB: db, Tx: tx}
+}
+
+// FindByClientID ...
+func (model apiClientModel) FindByClientID(clientID string) (d ApiClientEntity, err error) {
+	sql := `SELECT "id", "client_id", "name", "secret_hash", "signing_secret", "scopes", "enabled", "created_at", "disabled_at"
+		FROM "api_client" WHERE "client_id" = $1`
+	err = model.DB.QueryRow(sql, clientID).Scan(
+		&d.ID, &d.ClientID, &d.Name, &d.SecretHash, &d.SigningSecret, pq.Array(&d.Scopes),
+		&d.Enabled, &d.CreatedAt, &d.DisabledAt,
+	)
+	if err != nil {
+		if err.Error() == helper.SQLHandlerErrorRowNull {
+			return d, nil
+		}
+
+		return d, err
+	}
+
+	return d, err
+}
+
+// FindAll ...
+func (model apiClientModel) FindAll() (data []ApiClientEntity, err error) {
+	sql := `SELECT "id", "client_id", "name", "secret_hash", "signing_secret", "scopes", "enabled", "created_at", "disabled_at"
+		FROM "api_client" ORDER BY "created_at"`
+	rows, err := model.DB.Query(sql)
+	if err != nil {
+		return data, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d := ApiClientEntity{}
+		err = rows.Scan(
+			&d.ID, &d.ClientID, &d.Name, &d.SecretHash, &d.SigningSecret, pq.Array(&d.Scopes),
+			&d.Enabled, &d.CreatedAt, &d.DisabledAt,
+		)
+		if err != nil {
+			return data, err
+		}
+		data = append(data, d)
+	}
+
+	return data, rows.Err()
+}
+
+// Store ...
+func (model apiClientModel) Store(body ApiClientEntity) (res string, err error) {
+	sql := `INSERT INTO "api_client" (
+			"client_id", "name", "secret_hash", "signing_secret", "scopes", "enabled"
+		) VALUES($1, $2, $3, $4, $5, $6) RETURNING "id"`
+	err = model.DB.QueryRow(sql, body.ClientID, body.Name, body.SecretHash, body.SigningSecret, pq.Array(body.Scopes), body.Enabled).Scan(&res)
+
+	return res, err
+}
+
+// UpdateSecret replace the hash of the secret, the previous secret stops working at once
+func (model apiClientModel) UpdateSecret(clientID, secretHash, signingSecret string) (res string, err error) {
+	sql := `UPDATE "api_client" SET "secret_hash" = $1, "signing_secret" = $2 WHERE "client_id" = $3 RETURNING "id"`
+	err = model.DB.QueryRow(sql, secretHash, signingSecret, clientID).Scan(&res)
+	if err != nil && err.Error() == helper.SQLHandlerErrorRowNull {
+		return "", nil
+	}
+
+	return res, err
+}
+
+// UpdateEnabled ...
+func (model apiClientModel) UpdateEnabled(clientID string, enabled bool) (res string, err error) {
+	sql := `UPDATE "api_client" SET "enabled" = $1, "disabled_at" = CASE WHEN $1 THEN NULL ELSE now() END
+		WHERE "client_id" = $2 RETURNING "id"`
+	err = model.DB.QueryRow(sql, enabled, clientID).Scan(&res)
+	if err != nil && err.Error() == helper.SQLHandlerErrorRowNull {
+		return "", nil
+	}
+
+	return res, err
+}
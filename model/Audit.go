@@ -0,0 +1,197 @@
+package model
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// auditModel ...
+type auditModel struct {
+	DB *sql.DB
+	Tx *sql.Tx
+}
+
+// IAudit ...
+type IAudit interface {
+	LockHead(chain, genesisHash string) (AuditHeadEntity, error)
+	UpdateHead(body AuditHeadEntity) error
+	Store(body AuditEventEntity) (int64, error)
+	FindAll(parameter AuditParameter) ([]AuditEventEntity, error)
+	FindAfter(chain string, seq int64, limit int) ([]AuditEventEntity, error)
+	FindHeads(afterChain string, limit int) ([]AuditHeadEntity, error)
+	StoreAccess(body AuditEventEntity) (int64, error)
+}
+
+// AuditEventEntity before and after are json snapshots, hash covers every other column but seq and
+// chain and chains to the hash of the previous event of the chain. Chain is the wallet id, or the
+// system chain for the events of no wallet, and empty on the events of the legacy single chain.
+type AuditEventEntity struct {
+	Seq       int64          `db:"seq"`
+	Chain     sql.NullString `db:"chain"`
+	Actor     string         `db:"actor"`
+	Action    string         `db:"action"`
+	WalletID  sql.NullString `db:"wallet_id"`
+	Before    sql.NullString `db:"before"`
+	After     sql.NullString `db:"after"`
+	Reason    sql.NullString `db:"reason"`
+	RequestID sql.NullString `db:"request_id"`
+	IP        sql.NullString `db:"ip"`
+	CreatedAt time.Time      `db:"created_at"`
+	PrevHash  string         `db:"prev_hash"`
+	Hash      string         `db:"hash"`
+}
+
+// AuditHeadEntity the latest event of a chain, an event removed from the end of the chain no
+// longer matches it. Seq is 0 and hash the genesis hash while the chain is empty.
+type AuditHeadEntity struct {
+	Chain string `db:"chain"`
+	Seq   int64  `db:"seq"`
+	Hash  string `db:"hash"`
+}
+
+// AuditParameter every filter is optional, the events are paged by seq, the latest first
+type AuditParameter struct {
+	WalletID  string
+	Actor     string
+	Action    string
+	CursorSeq int64
+	Limit     int
+}
+
+// NewAuditModel ...
+func NewAuditModel(db *sql.DB, tx *sql.Tx) IAudit {
+	return &auditModel{DB: db, Tx: tx}
+}
+
+// LockHead lock the head of the chain until the transaction ends, the head of a new chain is created
+// at the genesis hash. Must be called with a transaction.
+func (model auditModel) LockHead(chain, genesisHash string) (res AuditHeadEntity, err error) {
+	sql := `INSERT INTO "audit_head" ("chain", "seq", "hash") VALUES($1, 0, $2) ON CONFLICT ("chain") DO NOTHING`
+	_, err = model.Tx.Exec(sql, chain, genesisHash)
+	if err != nil {
+		return res, err
+	}
+
+	sql = `SELECT "chain", "seq", "hash" FROM "audit_head" WHERE "chain" = $1 FOR UPDATE`
+	err = model.Tx.QueryRow(sql, chain).Scan(&res.Chain, &res.Seq, &res.Hash)
+
+	return res, err
+}
+
+// UpdateHead must be called after LockHead
+func (model auditModel) UpdateHead(body AuditHeadEntity) error {
+	sql := `UPDATE "audit_head" SET "seq" = $2, "hash" = $3 WHERE "chain" = $1`
+	_, err := model.Tx.Exec(sql, body.Chain, body.Seq, body.Hash)
+
+	return err
+}
+
+// Store must be called with a transaction
+func (model auditModel) Store(body AuditEventEntity) (res int64, err error) {
+	sql := `INSERT INTO "audit_event" (
+			"chain", "actor", "action", "wallet_id", "before", "after", "reason", "request_id", "ip", "created_at", "prev_hash", "hash"
+		) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING "seq"`
+	err = model.Tx.QueryRow(
+		sql, body.Chain, body.Actor, body.Action, body.WalletID, body.Before, body.After, body.Reason,
+		body.RequestID, body.IP, body.CreatedAt, body.PrevHash, body.Hash,
+	).Scan(&res)
+
+	return res, err
+}
+
+// StoreAccess record an operator read in the access log, it is not chained and needs no transaction.
+// Only the actor, action, wallet, detail (after), request id, ip and time are recorded.
+func (model auditModel) StoreAccess(body AuditEventEntity) (res int64, err error) {
+	sql := `INSERT INTO "audit_access" ("actor", "action", "wallet_id", "detail", "request_id", "ip", "created_at")
+		VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING "seq"`
+	err = model.DB.QueryRow(
+		sql, body.Actor, body.Action, body.WalletID, body.After, body.RequestID, body.IP, body.CreatedAt,
+	).Scan(&res)
+
+	return res, err
+}
+
+// FindAll ...
+func (model auditModel) FindAll(parameter AuditParameter) (data []AuditEventEntity, err error) {
+	var (
+		conditions = []string{"TRUE"}
+		args       []interface{}
+	)
+	addArg := func(val interface{}) string {
+		args = append(args, val)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if parameter.WalletID != "" {
+		conditions = append(conditions, `"wallet_id" = `+addArg(parameter.WalletID)+`::uuid`)
+	}
+	if parameter.Actor != "" {
+		conditions = append(conditions, `"actor" = `+addArg(parameter.Actor))
+	}
+	if parameter.Action != "" {
+		conditions = append(conditions, `"action" = `+addArg(parameter.Action))
+	}
+	if parameter.CursorSeq > 0 {
+		conditions = append(conditions, `"seq" < `+addArg(parameter.CursorSeq))
+	}
+
+	sql := `SELECT ` + auditColumns + ` FROM "audit_event" WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY "seq" DESC LIMIT ` + addArg(parameter.Limit)
+
+	return model.query(sql, args...)
+}
+
+// FindAfter the events of the chain following seq in chain order, an empty chain is the legacy chain
+func (model auditModel) FindAfter(chain string, seq int64, limit int) (data []AuditEventEntity, err error) {
+	sql := `SELECT ` + auditColumns + ` FROM "audit_event"
+		WHERE "chain" IS NOT DISTINCT FROM $1 AND "seq" > $2 ORDER BY "seq" LIMIT $3`
+
+	return model.query(sql, newNullString(chain), seq, limit)
+}
+
+// FindHeads the heads of the chains following afterChain
+func (model auditModel) FindHeads(afterChain string, limit int) (data []AuditHeadEntity, err error) {
+	sql := `SELECT "chain", "seq", "hash" FROM "audit_head" WHERE "chain" > $1 ORDER BY "chain" LIMIT $2`
+	rows, err := model.DB.Query(sql, afterChain, limit)
+	if err != nil {
+		return data, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d := AuditHeadEntity{}
+		err = rows.Scan(&d.Chain, &d.Seq, &d.Hash)
+		if err != nil {
+			return data, err
+		}
+		data = append(data, d)
+	}
+
+	return data, rows.Err()
+}
+
+const auditColumns = `"seq", "chain", "actor", "action", "wallet_id", "before", "after", "reason", "request_id", "ip", "created_at", "prev_hash", "hash"`
+
+func (model auditModel) query(sql string, args ...interface{}) (data []AuditEventEntity, err error) {
+	rows, err := model.DB.Query(sql, args...)
+	if err != nil {
+		return data, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d := AuditEventEntity{}
+		err = rows.Scan(
+			&d.Seq, &d.Chain, &d.Actor, &d.Action, &d.WalletID, &d.Before, &d.After, &d.Reason,
+			&d.RequestID, &d.IP, &d.CreatedAt, &d.PrevHash, &d.Hash,
+		)
+		if err != nil {
+			return data, err
+		}
+		data = append(data, d)
+	}
+
+	return data, rows.Err()
+}
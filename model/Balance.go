@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"julo-backend/helper"
 	"julo-backend/usecase/viewmodel"
+	"strconv"
+	"strings"
 )
 
 // balanceModel ...
@@ -15,21 +17,49 @@ type balanceModel struct {
 // IBalance ...
 type IBalance interface {
 	ReferenceExist(referenceID string) (bool, error)
-	StoreWd(body viewmodel.WithdrawalResp) (string, error)
-	StoreDe(body viewmodel.DepositResp) (string, error)
+	PendingExist(ownedByIndex string) (bool, error)
+	StoreWd(body viewmodel.WithdrawalResp, withdrawnByIndex string) (string, error)
+	StoreDe(body viewmodel.DepositResp, depositedByIndex string) (string, error)
 	UpdateStatus(id string, status string) error
+	FindStatusForUpdate(id string) (string, error)
+	UpdateFailure(id string, status string, reason string) error
+	Reopen(id string) error
+	FindAllByOwner(parameter BalanceParameter) ([]TransactionEntity, error)
+	FindByID(id, ownedByIndex, types string) (BalanceEntity, error)
+	FindByReferenceID(referenceID, ownedByIndex, types string) (BalanceEntity, error)
 }
 
-// BalanceEntity ....
+// BalanceEntity deposited_by and withdrawn_by are encrypted
 type BalanceEntity struct {
-	ID          string         `db:"id"`
-	Amount      int            `db:"amaout"`
-	Status      string         `db:"status"`
-	ReferenceID string         `db:"reference_id"`
-	DepositedBy sql.NullString `db:"deposited_by"`
-	DepositedAt sql.NullString `db:"deposited_at"`
-	WithdrawnBy sql.NullString `db:"withdrawn_by"`
-	WithdrawnAt sql.NullString `db:"withdrawn_at"`
+	ID            string         `db:"id"`
+	Amount        int            `db:"amaout"`
+	Status        string         `db:"status"`
+	ReferenceID   string         `db:"reference_id"`
+	DepositedBy   sql.NullString `db:"deposited_by"`
+	DepositedAt   sql.NullString `db:"deposited_at"`
+	WithdrawnBy   sql.NullString `db:"withdrawn_by"`
+	WithdrawnAt   sql.NullString `db:"withdrawn_at"`
+	FailureReason sql.NullString `db:"failure_reason"`
+}
+
+// TransactionEntity a row of the transaction history, a balance row or a transfer
+type TransactionEntity struct {
+	BalanceEntity
+	Type string `db:"type"`
+}
+
+// BalanceParameter ...
+type BalanceParameter struct {
+	// OwnedByIndex blind index of the owner
+	OwnedByIndex string
+	Type         string
+	Status       string
+	StartDate    string
+	EndDate      string
+	CursorDate   string
+	CursorID     string
+	Sort         string
+	Limit        int
 }
 
 // NewBalanceModel ...
@@ -51,20 +81,53 @@ func (model balanceModel) ReferenceExist(referenceID string) (bool, error) {
 	return true, nil
 }
 
-func (model balanceModel) StoreWd(body viewmodel.WithdrawalResp) (string, error) {
+// PendingExist whether a deposit or withdrawal of the owner is still pending
+func (model balanceModel) PendingExist(ownedByIndex string) (bool, error) {
+	var id string
+	sql := `SELECT "id" FROM "balance" WHERE ("deposited_by_index" = $1 OR "withdrawn_by_index" = $1) AND "status" = $2 LIMIT 1`
+	var err error
+	if model.Tx != nil {
+		err = model.Tx.QueryRow(sql, ownedByIndex, helper.StatusPending).Scan(&id)
+	} else {
+		err = model.DB.QueryRow(sql, ownedByIndex, helper.StatusPending).Scan(&id)
+	}
+	if err != nil {
+		if err.Error() == helper.SQLHandlerErrorRowNull {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// StoreWd the owner of the body must already be encrypted
+func (model balanceModel) StoreWd(body viewmodel.WithdrawalResp, withdrawnByIndex string) (string, error) {
 	var id string
-	sql := `INSERT INTO "balance" ("amount", "status", "reference_id", "withdrawn_by", "withdrawn_at") VALUES ($1, $2, $3, $4, $5) returning "id"`
+	sql := `INSERT INTO "balance" ("amount", "status", "reference_id", "withdrawn_by", "withdrawn_by_index", "withdrawn_at", "destination") VALUES ($1, $2, $3, $4, $5, $6, $7) returning "id"`
 
-	err := model.DB.QueryRow(sql, body.Amount, body.Status, body.ReferenceID, body.WithdrawnBy, body.WithdrawnAt).Scan(&id)
+	var err error
+	if model.Tx != nil {
+		err = model.Tx.QueryRow(sql, body.Amount, body.Status, body.ReferenceID, body.WithdrawnBy, withdrawnByIndex, body.WithdrawnAt, newNullString(body.Destination)).Scan(&id)
+	} else {
+		err = model.DB.QueryRow(sql, body.Amount, body.Status, body.ReferenceID, body.WithdrawnBy, withdrawnByIndex, body.WithdrawnAt, newNullString(body.Destination)).Scan(&id)
+	}
 
 	return id, err
 }
 
-func (model balanceModel) StoreDe(body viewmodel.DepositResp) (string, error) {
+// StoreDe the owner of the body must already be encrypted
+func (model balanceModel) StoreDe(body viewmodel.DepositResp, depositedByIndex string) (string, error) {
 	var id string
-	sql := `INSERT INTO "balance" ("amount", "status", "reference_id", "deposited_by", "deposited_at") VALUES ($1, $2, $3, $4, $5) returning "id"`
+	sql := `INSERT INTO "balance" ("amount", "status", "reference_id", "deposited_by", "deposited_by_index", "deposited_at") VALUES ($1, $2, $3, $4, $5, $6) returning "id"`
 
-	err := model.DB.QueryRow(sql, body.Amount, body.Status, body.ReferenceID, body.DepositedBy, body.DepositedAt).Scan(&id)
+	var err error
+	if model.Tx != nil {
+		err = model.Tx.QueryRow(sql, body.Amount, body.Status, body.ReferenceID, body.DepositedBy, depositedByIndex, body.DepositedAt).Scan(&id)
+	} else {
+		err = model.DB.QueryRow(sql, body.Amount, body.Status, body.ReferenceID, body.DepositedBy, depositedByIndex, body.DepositedAt).Scan(&id)
+	}
 
 	return id, err
 }
@@ -80,3 +143,154 @@ func (model balanceModel) UpdateStatus(id string, status string) (err error) {
 
 	return err
 }
+
+// FindStatusForUpdate lock the balance row until the transaction ends, must be called with a transaction
+func (model balanceModel) FindStatusForUpdate(id string) (string, error) {
+	var status string
+	sql := `SELECT "status" FROM "balance" WHERE "id" = $1 FOR UPDATE`
+	err := model.Tx.QueryRow(sql, id).Scan(&status)
+	if err != nil {
+		if err.Error() == helper.SQLHandlerErrorRowNull {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	return status, err
+}
+
+// UpdateFailure set a terminal status together with the reason of the failure,
+// only a pending row can be moved to a terminal state
+func (model balanceModel) UpdateFailure(id string, status string, reason string) (err error) {
+	sql := `UPDATE "balance" SET "status" = $1, "failure_reason" = $2 WHERE "id" = $3 AND "status" = $4`
+	if model.Tx != nil {
+		_, err = model.Tx.Exec(sql, status, reason, id, helper.StatusPending)
+	} else {
+		_, err = model.DB.Exec(sql, status, reason, id, helper.StatusPending)
+	}
+
+	return err
+}
+
+// Reopen move a failed row back to pending so its message can be processed again
+func (model balanceModel) Reopen(id string) (err error) {
+	sql := `UPDATE "balance" SET "status" = $1, "failure_reason" = NULL WHERE "id" = $2 AND "status" = $3`
+	if model.Tx != nil {
+		_, err = model.Tx.Exec(sql, helper.StatusPending, id, helper.StatusFailed)
+	} else {
+		_, err = model.DB.Exec(sql, helper.StatusPending, id, helper.StatusFailed)
+	}
+
+	return err
+}
+
+// FindAllByOwner the deposits, withdrawals and transfers of an owner, a transfer is listed with
+// its sender as withdrawn_by and its receiver as deposited_by. An empty owner lists the rows of
+// every owner, only the admin api does so.
+func (model balanceModel) FindAllByOwner(parameter BalanceParameter) (data []TransactionEntity, err error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	addArg := func(val interface{}) string {
+		args = append(args, val)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conditions = append(conditions, `TRUE`)
+	if parameter.OwnedByIndex != "" {
+		owner := addArg(parameter.OwnedByIndex)
+		conditions = append(conditions, `("deposited_by_index" = `+owner+` OR "withdrawn_by_index" = `+owner+`)`)
+	}
+	if parameter.Type != "" {
+		conditions = append(conditions, `"type" = `+addArg(parameter.Type))
+	}
+	if parameter.Status != "" {
+		conditions = append(conditions, `"status" = `+addArg(parameter.Status))
+	}
+	if parameter.StartDate != "" {
+		conditions = append(conditions, `"transacted_at" >= `+addArg(parameter.StartDate)+`::timestamptz`)
+	}
+	if parameter.EndDate != "" {
+		conditions = append(conditions, `"transacted_at" < `+addArg(parameter.EndDate)+`::timestamptz`)
+	}
+
+	sort := "DESC"
+	operator := "<"
+	if strings.ToLower(parameter.Sort) == "asc" {
+		sort = "ASC"
+		operator = ">"
+	}
+	if parameter.CursorID != "" {
+		conditions = append(conditions, `("transacted_at", "id") `+operator+` (`+addArg(parameter.CursorDate)+`::timestamptz, `+addArg(parameter.CursorID)+`::uuid)`)
+	}
+
+	sql := `SELECT "id", "type", "amount", "status", "reference_id", "deposited_by", "deposited_at", "withdrawn_by", "withdrawn_at", "failure_reason"
+		FROM (
+			SELECT "id", CASE WHEN "deposited_by" IS NOT NULL THEN '` + helper.TypeDeposit + `' ELSE '` + helper.TypeWithdrawal + `' END AS "type",
+				"amount", "status", "reference_id", "deposited_by", "deposited_by_index", "deposited_at",
+				"withdrawn_by", "withdrawn_by_index", "withdrawn_at", "failure_reason",
+				COALESCE("deposited_at", "withdrawn_at") AS "transacted_at"
+			FROM "balance"
+			UNION ALL
+			SELECT "id", '` + helper.TypeTransfer + `', "amount", "status", "reference_id", "received_by", "received_by_index", "transferred_at",
+				"transferred_by", "transferred_by_index", "transferred_at", NULL, "transferred_at"
+			FROM "transfer"
+		) AS "transaction" WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY "transacted_at" ` + sort + `, "id" ` + sort + `
+		LIMIT ` + addArg(parameter.Limit)
+	rows, err := model.DB.Query(sql, args...)
+	if err != nil {
+		return data, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d := TransactionEntity{}
+		err = rows.Scan(
+			&d.ID, &d.Type, &d.Amount, &d.Status, &d.ReferenceID, &d.DepositedBy,
+			&d.DepositedAt, &d.WithdrawnBy, &d.WithdrawnAt, &d.FailureReason,
+		)
+		if err != nil {
+			return data, err
+		}
+		data = append(data, d)
+	}
+
+	return data, rows.Err()
+}
+
+// FindByID ...
+func (model balanceModel) FindByID(id, ownedByIndex, types string) (BalanceEntity, error) {
+	return model.findOne(`"id"`, id, ownedByIndex, types)
+}
+
+// FindByReferenceID ...
+func (model balanceModel) FindByReferenceID(referenceID, ownedByIndex, types string) (BalanceEntity, error) {
+	return model.findOne(`"reference_id"`, referenceID, ownedByIndex, types)
+}
+
+// findOne find a balance row by a column, scoped to the owner of the deposit or withdrawal
+func (model balanceModel) findOne(column, value, ownedByIndex, types string) (d BalanceEntity, err error) {
+	owner := `"deposited_by_index"`
+	if types == helper.TypeWithdrawal {
+		owner = `"withdrawn_by_index"`
+	}
+
+	sql := `SELECT "id", "amount", "status", "reference_id", "deposited_by", "deposited_at", "withdrawn_by", "withdrawn_at", "failure_reason"
+		FROM "balance" WHERE ` + column + ` = $1 AND ` + owner + ` = $2`
+	err = model.DB.QueryRow(sql, value, ownedByIndex).Scan(
+		&d.ID, &d.Amount, &d.Status, &d.ReferenceID, &d.DepositedBy,
+		&d.DepositedAt, &d.WithdrawnBy, &d.WithdrawnAt, &d.FailureReason,
+	)
+	if err != nil {
+		if err.Error() == helper.SQLHandlerErrorRowNull {
+			return d, nil
+		}
+
+		return d, err
+	}
+
+	return d, err
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"database/sql"
+)
+
+// EncryptedColumn column storing an encrypted customer id, Index is the column of its blind index
+// and is empty when the column is never looked up
+type EncryptedColumn struct {
+	Table  string
+	Column string
+	Index  string
+}
+
+// AAD the additional data a value of the column is encrypted with, a ciphertext moved to
+// another column does not decrypt
+func (column EncryptedColumn) AAD() string {
+	return column.Table + "." + column.Column
+}
+
+var (
+	// WalletOwnedBy ...
+	WalletOwnedBy = EncryptedColumn{Table: "wallet", Column: "owned_by", Index: "owned_by_index"}
+	// BalanceDepositedBy ...
+	BalanceDepositedBy = EncryptedColumn{Table: "balance", Column: "deposited_by", Index: "deposited_by_index"}
+	// BalanceWithdrawnBy ...
+	BalanceWithdrawnBy = EncryptedColumn{Table: "balance", Column: "withdrawn_by", Index: "withdrawn_by_index"}
+	// TransferTransferredBy ...
+	TransferTransferredBy = EncryptedColumn{Table: "transfer", Column: "transferred_by", Index: "transferred_by_index"}
+	// TransferReceivedBy ...
+	TransferReceivedBy = EncryptedColumn{Table: "transfer", Column: "received_by", Index: "received_by_index"}
+)
+
+// EncryptedColumns every column storing a customer id
+var EncryptedColumns = []EncryptedColumn{
+	WalletOwnedBy,
+	BalanceDepositedBy,
+	BalanceWithdrawnBy,
+	TransferTransferredBy,
+	TransferReceivedBy,
+}
+
+// encryptionModel ...
+type encryptionModel struct {
+	DB *sql.DB
+	Tx *sql.Tx
+}
+
+// IEncryption ...
+type IEncryption interface {
+	FindOutdated(column EncryptedColumn, prefix string, limit int) ([]EncryptedValueEntity, error)
+	UpdateValue(column EncryptedColumn, id, value, index string) error
+}
+
+// EncryptedValueEntity ....
+type EncryptedValueEntity struct {
+	ID    string `db:"id"`
+	Value string `db:"value"`
+}
+
+// NewEncryptionModel ...
+func NewEncryptionModel(db *sql.DB, tx *sql.Tx) IEncryption {
+	return &encryptionModel{DB: db, Tx: tx}
+}
+
+// FindOutdated lock a batch of values which do not start with the prefix of the current
+// ciphertext version or have no blind index yet, must be called with a transaction
+func (model encryptionModel) FindOutdated(column EncryptedColumn, prefix string, limit int) (data []EncryptedValueEntity, err error) {
+	outdated := `"` + column.Column + `"::TEXT NOT LIKE $1`
+	if column.Index != "" {
+		outdated = `(` + outdated + ` OR "` + column.Index + `" IS NULL)`
+	}
+	sql := `SELECT "id", "` + column.Column + `"::TEXT FROM "` + column.Table + `"
+		WHERE "` + column.Column + `" IS NOT NULL AND ` + outdated + `
+		LIMIT $2 FOR UPDATE SKIP LOCKED`
+	rows, err := model.Tx.Query(sql, prefix+"%", limit)
+	if err != nil {
+		return data, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d := EncryptedValueEntity{}
+		err = rows.Scan(&d.ID, &d.Value)
+		if err != nil {
+			return data, err
+		}
+		data = append(data, d)
+	}
+
+	return data, rows.Err()
+}
+
+// UpdateValue ...
+func (model encryptionModel) UpdateValue(column EncryptedColumn, id, value, index string) (err error) {
+	if column.Index == "" {
+		sql := `UPDATE "` + column.Table + `" SET "` + column.Column + `" = $1 WHERE "id" = $2`
+		_, err = model.Tx.Exec(sql, value, id)
+		return err
+	}
+
+	sql := `UPDATE "` + column.Table + `" SET "` + column.Column + `" = $1, "` + column.Index + `" = $2 WHERE "id" = $3`
+	_, err = model.Tx.Exec(sql, value, index, id)
+
+	return err
+}
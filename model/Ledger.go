@@ -0,0 +1,125 @@
+package model
+
+import (
+	"database/sql"
+	"julo-backend/helper"
+	"julo-backend/usecase/viewmodel"
+)
+
+// ledgerModel ...
+type ledgerModel struct {
+	DB *sql.DB
+	Tx *sql.Tx
+}
+
+// ILedger ...
+type ILedger interface {
+	FindAccountByCode(code string) (LedgerAccountEntity, error)
+	StoreAccount(body viewmodel.LedgerAccountVM) (string, error)
+	StoreEntry(body viewmodel.JournalEntryVM) (string, error)
+	StoreLine(entryID string, body viewmodel.JournalLineVM) (string, error)
+	UpdateWalletBalance(accountID string, amount int) error
+}
+
+// LedgerAccountEntity balance is the running balance of a wallet account, it is not kept for the
+// system accounts
+type LedgerAccountEntity struct {
+	ID        string         `db:"id"`
+	Code      string         `db:"code"`
+	Type      string         `db:"type"`
+	WalletID  sql.NullString `db:"wallet_id"`
+	Balance   int            `db:"balance"`
+	CreatedAt string         `db:"created_at"`
+}
+
+// JournalEntryEntity ....
+type JournalEntryEntity struct {
+	ID          string         `db:"id"`
+	BalanceID   sql.NullString `db:"balance_id"`
+	TransferID  sql.NullString `db:"transfer_id"`
+	Type        string         `db:"type"`
+	Description sql.NullString `db:"description"`
+	CreatedAt   string         `db:"created_at"`
+}
+
+// JournalLineEntity ....
+type JournalLineEntity struct {
+	ID             string `db:"id"`
+	JournalEntryID string `db:"journal_entry_id"`
+	AccountID      string `db:"account_id"`
+	Debit          int    `db:"debit"`
+	Credit         int    `db:"credit"`
+}
+
+// NewLedgerModel ...
+func NewLedgerModel(db *sql.DB, tx *sql.Tx) ILedger {
+	return &ledgerModel{DB: db, Tx: tx}
+}
+
+// FindAccountByCode ...
+func (model ledgerModel) FindAccountByCode(code string) (d LedgerAccountEntity, err error) {
+	sql := `SELECT "id", "code", "type", "wallet_id", "balance", "created_at" FROM "ledger_account" WHERE "code" = $1`
+	if model.Tx != nil {
+		err = model.Tx.QueryRow(sql, code).Scan(&d.ID, &d.Code, &d.Type, &d.WalletID, &d.Balance, &d.CreatedAt)
+	} else {
+		err = model.DB.QueryRow(sql, code).Scan(&d.ID, &d.Code, &d.Type, &d.WalletID, &d.Balance, &d.CreatedAt)
+	}
+	if err != nil {
+		if err.Error() == helper.SQLHandlerErrorRowNull {
+			return d, nil
+		}
+
+		return d, err
+	}
+
+	return d, err
+}
+
+// StoreAccount ...
+func (model ledgerModel) StoreAccount(body viewmodel.LedgerAccountVM) (res string, err error) {
+	sql := `INSERT INTO "ledger_account" ("code", "type", "wallet_id") VALUES ($1, $2, $3) RETURNING "id"`
+	if model.Tx != nil {
+		err = model.Tx.QueryRow(sql, body.Code, body.Type, newNullString(body.WalletID)).Scan(&res)
+	} else {
+		err = model.DB.QueryRow(sql, body.Code, body.Type, newNullString(body.WalletID)).Scan(&res)
+	}
+
+	return res, err
+}
+
+// StoreEntry ...
+func (model ledgerModel) StoreEntry(body viewmodel.JournalEntryVM) (res string, err error) {
+	sql := `INSERT INTO "journal_entry" ("balance_id", "transfer_id", "type", "description") VALUES ($1, $2, $3, $4) RETURNING "id"`
+	if model.Tx != nil {
+		err = model.Tx.QueryRow(sql, newNullString(body.BalanceID), newNullString(body.TransferID), body.Type, newNullString(body.Description)).Scan(&res)
+	} else {
+		err = model.DB.QueryRow(sql, newNullString(body.BalanceID), newNullString(body.TransferID), body.Type, newNullString(body.Description)).Scan(&res)
+	}
+
+	return res, err
+}
+
+// StoreLine ...
+func (model ledgerModel) StoreLine(entryID string, body viewmodel.JournalLineVM) (res string, err error) {
+	sql := `INSERT INTO "journal_line" ("journal_entry_id", "account_id", "debit", "credit") VALUES ($1, $2, $3, $4) RETURNING "id"`
+	if model.Tx != nil {
+		err = model.Tx.QueryRow(sql, entryID, body.AccountID, body.Debit, body.Credit).Scan(&res)
+	} else {
+		err = model.DB.QueryRow(sql, entryID, body.AccountID, body.Debit, body.Credit).Scan(&res)
+	}
+
+	return res, err
+}
+
+// UpdateWalletBalance add the amount to the running balance of a wallet account, the system
+// accounts are posted by every operation and are left alone
+func (model ledgerModel) UpdateWalletBalance(accountID string, amount int) (err error) {
+	sql := `UPDATE "ledger_account" SET "balance" = "balance" + $2 WHERE "id" = $1 AND "type" = $3`
+	if model.Tx != nil {
+		_, err = model.Tx.Exec(sql, accountID, amount, helper.LedgerAccountTypeWallet)
+	} else {
+		_, err = model.DB.Exec(sql, accountID, amount, helper.LedgerAccountTypeWallet)
+	}
+
+	return err
+}
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"database/sql"
+	"julo-backend/helper"
+	"julo-backend/usecase/viewmodel"
+
+	"github.com/lib/pq"
+)
+
+// outboxModel ...
+type outboxModel struct {
+	DB *sql.DB
+	Tx *sql.Tx
+}
+
+// IOutbox ...
+type IOutbox interface {
+	Store(body viewmodel.OutboxVM) (string, error)
+	Claim(limit, leaseSeconds int) ([]OutboxEntity, error)
+	MarkSent(id string) error
+	MarkFailed(id, reason string) error
+	Release(ids []string) error
+}
+
+// OutboxEntity ....
+type OutboxEntity struct {
+	ID              string         `db:"id"`
+	Queue           string         `db:"queue"`
+	DeadLetterQueue string         `db:"dead_letter_queue"`
+	Payload         string         `db:"payload"`
+	Status          string         `db:"status"`
+	Attempts        int            `db:"attempts"`
+	LastError       sql.NullString `db:"last_error"`
+	CreatedAt       string         `db:"created_at"`
+	SentAt          sql.NullString `db:"sent_at"`
+}
+
+// NewOutboxModel ...
+func NewOutboxModel(db *sql.DB, tx *sql.Tx) IOutbox {
+	return &outboxModel{DB: db, Tx: tx}
+}
+
+// Store ...
+func (model outboxModel) Store(body viewmodel.OutboxVM) (res string, err error) {
+	sql := `INSERT INTO "outbox" ("queue", "dead_letter_queue", "payload", "status") VALUES ($1, $2, $3, $4) RETURNING "id"`
+	if model.Tx != nil {
+		err = model.Tx.QueryRow(sql, body.Queue, body.DeadLetterQueue, body.Payload, helper.StatusPending).Scan(&res)
+	} else {
+		err = model.DB.QueryRow(sql, body.Queue, body.DeadLetterQueue, body.Payload, helper.StatusPending).Scan(&res)
+	}
+
+	return res, err
+}
+
+// Claim lease a batch of pending messages to the caller for leaseSeconds, rows claimed by another
+// relay are skipped until their lease expires. It runs in its own statement so no lock is held
+// once it returns.
+func (model outboxModel) Claim(limit, leaseSeconds int) (data []OutboxEntity, err error) {
+	sql := `WITH "claimed" AS (
+			UPDATE "outbox" SET "claimed_until" = now() + $3 * interval '1 second'
+			WHERE "id" IN (
+				SELECT "id" FROM "outbox" WHERE "status" = $1 AND ("claimed_until" IS NULL OR "claimed_until" < now())
+				ORDER BY "created_at" ASC LIMIT $2 FOR UPDATE SKIP LOCKED
+			)
+			RETURNING "id", "queue", "dead_letter_queue", "payload", "status", "attempts", "last_error", "created_at", "sent_at"
+		)
+		SELECT "id", "queue", "dead_letter_queue", "payload", "status", "attempts", "last_error", "created_at", "sent_at"
+		FROM "claimed" ORDER BY "created_at" ASC`
+	rows, err := model.DB.Query(sql, helper.StatusPending, limit, leaseSeconds)
+	if err != nil {
+		return data, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d := OutboxEntity{}
+		err = rows.Scan(
+			&d.ID, &d.Queue, &d.DeadLetterQueue, &d.Payload, &d.Status,
+			&d.Attempts, &d.LastError, &d.CreatedAt, &d.SentAt,
+		)
+		if err != nil {
+			return data, err
+		}
+		data = append(data, d)
+	}
+
+	return data, rows.Err()
+}
+
+// MarkSent ...
+func (model outboxModel) MarkSent(id string) (err error) {
+	sql := `UPDATE "outbox" SET "status" = $1, "sent_at" = now(), "claimed_until" = NULL WHERE "id" = $2`
+	if model.Tx != nil {
+		_, err = model.Tx.Exec(sql, helper.StatusSent, id)
+	} else {
+		_, err = model.DB.Exec(sql, helper.StatusSent, id)
+	}
+
+	return err
+}
+
+// MarkFailed keep the message pending and record the publish error
+func (model outboxModel) MarkFailed(id, reason string) (err error) {
+	sql := `UPDATE "outbox" SET "attempts" = "attempts" + 1, "last_error" = $1, "claimed_until" = NULL WHERE "id" = $2`
+	if model.Tx != nil {
+		_, err = model.Tx.Exec(sql, reason, id)
+	} else {
+		_, err = model.DB.Exec(sql, reason, id)
+	}
+
+	return err
+}
+
+// Release give back claimed messages which were not published
+func (model outboxModel) Release(ids []string) (err error) {
+	sql := `UPDATE "outbox" SET "claimed_until" = NULL WHERE "id" = ANY($1) AND "status" = $2`
+	if model.Tx != nil {
+		_, err = model.Tx.Exec(sql, pq.Array(ids), helper.StatusPending)
+	} else {
+		_, err = model.DB.Exec(sql, pq.Array(ids), helper.StatusPending)
+	}
+
+	return err
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"database/sql"
+	"julo-backend/helper"
+	"julo-backend/usecase/viewmodel"
+)
+
+// transferModel ...
+type transferModel struct {
+	DB *sql.DB
+	Tx *sql.Tx
+}
+
+// ITransfer ...
+type ITransfer interface {
+	ReferenceExist(referenceID string) (bool, error)
+	Store(body viewmodel.TransferResp, transferredByIndex, receivedByIndex string) (string, error)
+}
+
+// TransferEntity ....
+type TransferEntity struct {
+	ID            string `db:"id"`
+	Amount        int    `db:"amount"`
+	Status        string `db:"status"`
+	ReferenceID   string `db:"reference_id"`
+	TransferredBy string `db:"transferred_by"`
+	ReceivedBy    string `db:"received_by"`
+	TransferredAt string `db:"transferred_at"`
+}
+
+// NewTransferModel ...
+func NewTransferModel(db *sql.DB, tx *sql.Tx) ITransfer {
+	return &transferModel{DB: db, Tx: tx}
+}
+
+// ReferenceExist ...
+func (model transferModel) ReferenceExist(referenceID string) (bool, error) {
+	var id string
+	sql := `SELECT "reference_id" FROM "transfer" WHERE "reference_id" = $1`
+	err := model.DB.QueryRow(sql, referenceID).Scan(&id)
+	if err != nil {
+		if err.Error() == helper.SQLHandlerErrorRowNull {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Store ...
+func (model transferModel) Store(body viewmodel.TransferResp, transferredByIndex, receivedByIndex string) (res string, err error) {
+	sql := `INSERT INTO "transfer" ("amount", "status", "reference_id", "transferred_by", "received_by", "transferred_at",
+		"transferred_by_index", "received_by_index") VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING "id"`
+	if model.Tx != nil {
+		err = model.Tx.QueryRow(sql, body.Amount, body.Status, body.ReferenceID, body.TransferredBy, body.ReceivedBy, body.TransferredAt,
+			transferredByIndex, receivedByIndex).Scan(&res)
+	} else {
+		err = model.DB.QueryRow(sql, body.Amount, body.Status, body.ReferenceID, body.TransferredBy, body.ReceivedBy, body.TransferredAt,
+			transferredByIndex, receivedByIndex).Scan(&res)
+	}
+
+	return res, err
+}
@@ -2,9 +2,10 @@ package model
 
 import (
 	"database/sql"
-	"fmt"
 	"julo-backend/helper"
 	"julo-backend/usecase/viewmodel"
+	"strconv"
+	"strings"
 )
 
 // walletModel ...
@@ -15,24 +16,65 @@ type walletModel struct {
 
 // IWallet ...
 type IWallet interface {
-	WalletExist(ownedBy string) (bool, error)
-	FindStatusByOwen(ownedBy string) (string, error)
-	FindBalanceByOwen(ownedBy string) (int, error)
-	FindByOwen(ownedBy string) (WalletEntity, error)
-	Store(body viewmodel.WalletEnableVM) (string, error)
-	Update(body viewmodel.WalletVM) (string, int, error)
-	MinusBalance(ownedBy string, amount int) (string, error)
-	PlusBalance(ownedBy string, amount int) (string, error)
+	WalletExist(ownedByIndex string) (bool, error)
+	FindStatusByOwen(ownedByIndex string) (string, error)
+	FindBalanceByOwen(ownedByIndex string) (int, error)
+	FindByOwen(ownedByIndex string) (WalletEntity, error)
+	FindByOwenForUpdate(ownedByIndex string) (WalletEntity, error)
+	FindByID(id string) (WalletEntity, error)
+	FindAll(parameter WalletParameter) ([]WalletEntity, error)
+	Store(body viewmodel.WalletEnableVM, ownedByIndex, createdByClient string) (string, error)
+	Update(ownedByIndex string, body viewmodel.WalletVM) (string, int, error)
+	Freeze(ownedByIndex string, body WalletFreezeEntity) (string, error)
+	Close(ownedByIndex, reason string, retentionYears int) (string, error)
+	StartClose(ownedByIndex, payoutID, reason string) (string, error)
+	CancelClose(ownedByIndex string) (string, error)
+	UpdateBalance(ownedByIndex string, balance int) (string, error)
+	AdoptLegacyOwner(plainOwner, owner, ownedByIndex string) (string, error)
 }
 
-// WalletEntity ....
+// WalletEntity owned_by is encrypted, owned_by_index is its blind index
 type WalletEntity struct {
-	ID         string         `db:"id"`
-	Balance    int            `db:"balance"`
-	OwnedBy    string         `db:"owned_by"`
-	Status     sql.NullString `db:"status"`
-	EnabledAt  sql.NullString `db:"enabled_at"`
-	DisabledAt sql.NullString `db:"disabled_at"`
+	ID           string         `db:"id"`
+	Balance      int            `db:"balance"`
+	OwnedBy      string         `db:"owned_by"`
+	OwnedByIndex string         `db:"owned_by_index"`
+	Status       sql.NullString `db:"status"`
+	EnabledAt    sql.NullString `db:"enabled_at"`
+	DisabledAt   sql.NullString `db:"disabled_at"`
+	// CreatedByClient only read by FindByID and FindAll
+	CreatedByClient sql.NullString `db:"created_by_client"`
+	FrozenAt        sql.NullString `db:"frozen_at"`
+	FrozenReason    sql.NullString `db:"frozen_reason"`
+	FrozenUntil     sql.NullString `db:"frozen_until"`
+	// FrozenAcceptsDeposit the frozen wallet still accepts deposits
+	FrozenAcceptsDeposit bool `db:"frozen_accepts_deposit"`
+	// FrozenFrom the status before the freeze, restored when the freeze expires
+	FrozenFrom   sql.NullString `db:"frozen_from"`
+	ClosedAt     sql.NullString `db:"closed_at"`
+	ClosedReason sql.NullString `db:"closed_reason"`
+	// RetainUntil the closed wallet and its history can not be deleted before
+	RetainUntil sql.NullString `db:"retain_until"`
+	// ClosingPayoutID the pending withdrawal paying out the balance of a closing wallet
+	ClosingPayoutID sql.NullString `db:"closing_payout_id"`
+	ClosingReason   sql.NullString `db:"closing_reason"`
+}
+
+// WalletFreezeEntity until is empty for a freeze lifted only by an operator
+type WalletFreezeEntity struct {
+	Reason         string
+	Until          string
+	AcceptsDeposit bool
+	From           string
+}
+
+// WalletParameter every filter is optional, the wallets are paged by id
+type WalletParameter struct {
+	ID           string
+	OwnedByIndex string
+	Status       string
+	CursorID     string
+	Limit        int
 }
 
 // NewWalletModel ...
@@ -40,10 +82,10 @@ func NewWalletModel(db *sql.DB, tx *sql.Tx) IWallet {
 	return &walletModel{DB: db, Tx: tx}
 }
 
-func (model walletModel) WalletExist(ownedBy string) (bool, error) {
+func (model walletModel) WalletExist(ownedByIndex string) (bool, error) {
 	var id sql.NullString
-	sql := `SELECT "id" FROM "wallet" WHERE "owned_by" = $1`
-	err := model.DB.QueryRow(sql, ownedBy).Scan(&id)
+	sql := `SELECT "id" FROM "wallet" WHERE "owned_by_index" = $1`
+	err := model.DB.QueryRow(sql, ownedByIndex).Scan(&id)
 	if err != nil {
 		if err.Error() == helper.SQLHandlerErrorRowNull {
 			return false, nil
@@ -55,10 +97,10 @@ func (model walletModel) WalletExist(ownedBy string) (bool, error) {
 	return true, err
 }
 
-func (model walletModel) FindStatusByOwen(ownedBy string) (string, error) {
+func (model walletModel) FindStatusByOwen(ownedByIndex string) (string, error) {
 	var status sql.NullString
-	sql := `SELECT "status" FROM "wallet" WHERE "owned_by" = $1`
-	err := model.DB.QueryRow(sql, ownedBy).Scan(&status)
+	sql := `SELECT "status" FROM "wallet" WHERE "owned_by_index" = $1`
+	err := model.DB.QueryRow(sql, ownedByIndex).Scan(&status)
 	if err != nil {
 		if err.Error() == helper.SQLHandlerErrorRowNull {
 			return "", nil
@@ -70,10 +112,10 @@ func (model walletModel) FindStatusByOwen(ownedBy string) (string, error) {
 	return status.String, err
 }
 
-func (model walletModel) FindBalanceByOwen(ownedBy string) (int, error) {
+func (model walletModel) FindBalanceByOwen(ownedByIndex string) (int, error) {
 	var balance int
-	sql := `SELECT "balance" FROM "wallet" WHERE "owned_by" = $1`
-	err := model.DB.QueryRow(sql, ownedBy).Scan(&balance)
+	sql := `SELECT "balance" FROM "wallet" WHERE "owned_by_index" = $1`
+	err := model.DB.QueryRow(sql, ownedByIndex).Scan(&balance)
 	if err != nil {
 		if err.Error() == helper.SQLHandlerErrorRowNull {
 			return 0, nil
@@ -85,12 +127,14 @@ func (model walletModel) FindBalanceByOwen(ownedBy string) (int, error) {
 	return balance, err
 }
 
-func (model walletModel) FindByOwen(ownedBy string) (WalletEntity, error) {
+func (model walletModel) FindByOwen(ownedByIndex string) (WalletEntity, error) {
 	var d WalletEntity
-	sql := `SELECT "id", "balance", "owned_by", "status", "enabled_at", "disabled_at" FROM "wallet" WHERE "owned_by" = $1`
-	err := model.DB.QueryRow(sql, ownedBy).Scan(
-		&d.ID, &d.Balance, &d.OwnedBy, &d.Status,
-		&d.EnabledAt, &d.DisabledAt,
+	sql := `SELECT "id", "balance", "owned_by", "owned_by_index", "status", "enabled_at", "disabled_at", ` + walletStatusColumns + ` FROM "wallet" WHERE "owned_by_index" = $1`
+	err := model.DB.QueryRow(sql, ownedByIndex).Scan(
+		&d.ID, &d.Balance, &d.OwnedBy, &d.OwnedByIndex, &d.Status,
+		&d.EnabledAt, &d.DisabledAt, &d.FrozenAt, &d.FrozenReason, &d.FrozenUntil,
+		&d.FrozenAcceptsDeposit, &d.FrozenFrom, &d.ClosedAt, &d.ClosedReason, &d.RetainUntil,
+		&d.ClosingPayoutID, &d.ClosingReason,
 	)
 	if err != nil {
 		if err.Error() == helper.SQLHandlerErrorRowNull {
@@ -103,44 +147,202 @@ func (model walletModel) FindByOwen(ownedBy string) (WalletEntity, error) {
 	return d, err
 }
 
-// Store ...
-func (model walletModel) Store(body viewmodel.WalletEnableVM) (res string, err error) {
+// FindByOwenForUpdate lock the wallet row until the transaction ends, must be called with a transaction
+func (model walletModel) FindByOwenForUpdate(ownedByIndex string) (WalletEntity, error) {
+	var d WalletEntity
+	sql := `SELECT "id", "balance", "owned_by", "owned_by_index", "status", "enabled_at", "disabled_at", ` + walletStatusColumns + ` FROM "wallet" WHERE "owned_by_index" = $1 FOR UPDATE`
+	err := model.Tx.QueryRow(sql, ownedByIndex).Scan(
+		&d.ID, &d.Balance, &d.OwnedBy, &d.OwnedByIndex, &d.Status,
+		&d.EnabledAt, &d.DisabledAt, &d.FrozenAt, &d.FrozenReason, &d.FrozenUntil,
+		&d.FrozenAcceptsDeposit, &d.FrozenFrom, &d.ClosedAt, &d.ClosedReason, &d.RetainUntil,
+		&d.ClosingPayoutID, &d.ClosingReason,
+	)
+	if err != nil {
+		if err.Error() == helper.SQLHandlerErrorRowNull {
+			return d, nil
+		}
+
+		return d, err
+	}
+
+	return d, err
+}
+
+// FindByID ...
+func (model walletModel) FindByID(id string) (WalletEntity, error) {
+	var d WalletEntity
+	sql := `SELECT "id", "balance", "owned_by", "owned_by_index", "status", "enabled_at", "disabled_at", "created_by_client", ` + walletStatusColumns + ` FROM "wallet" WHERE "id" = $1`
+	err := model.DB.QueryRow(sql, id).Scan(
+		&d.ID, &d.Balance, &d.OwnedBy, &d.OwnedByIndex, &d.Status,
+		&d.EnabledAt, &d.DisabledAt, &d.CreatedByClient, &d.FrozenAt, &d.FrozenReason,
+		&d.FrozenUntil, &d.FrozenAcceptsDeposit, &d.FrozenFrom, &d.ClosedAt, &d.ClosedReason, &d.RetainUntil,
+		&d.ClosingPayoutID, &d.ClosingReason,
+	)
+	if err != nil {
+		if err.Error() == helper.SQLHandlerErrorRowNull {
+			return d, nil
+		}
+
+		return d, err
+	}
+
+	return d, err
+}
+
+// FindAll ...
+func (model walletModel) FindAll(parameter WalletParameter) (data []WalletEntity, err error) {
+	var (
+		conditions = []string{"TRUE"}
+		args       []interface{}
+	)
+	addArg := func(val interface{}) string {
+		args = append(args, val)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if parameter.ID != "" {
+		conditions = append(conditions, `"id" = `+addArg(parameter.ID)+`::uuid`)
+	}
+	if parameter.OwnedByIndex != "" {
+		conditions = append(conditions, `"owned_by_index" = `+addArg(parameter.OwnedByIndex))
+	}
+	if parameter.Status != "" {
+		conditions = append(conditions, `"status" = `+addArg(parameter.Status))
+	}
+	if parameter.CursorID != "" {
+		conditions = append(conditions, `"id" > `+addArg(parameter.CursorID)+`::uuid`)
+	}
+
+	sql := `SELECT "id", "balance", "owned_by", "owned_by_index", "status", "enabled_at", "disabled_at", "created_by_client", ` + walletStatusColumns + `
+		FROM "wallet" WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY "id" LIMIT ` + addArg(parameter.Limit)
+	rows, err := model.DB.Query(sql, args...)
+	if err != nil {
+		return data, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d := WalletEntity{}
+		err = rows.Scan(
+			&d.ID, &d.Balance, &d.OwnedBy, &d.OwnedByIndex, &d.Status,
+			&d.EnabledAt, &d.DisabledAt, &d.CreatedByClient, &d.FrozenAt, &d.FrozenReason,
+			&d.FrozenUntil, &d.FrozenAcceptsDeposit, &d.FrozenFrom, &d.ClosedAt, &d.ClosedReason, &d.RetainUntil,
+			&d.ClosingPayoutID, &d.ClosingReason,
+		)
+		if err != nil {
+			return data, err
+		}
+		data = append(data, d)
+	}
+
+	return data, rows.Err()
+}
+
+// Store the owner of the body must already be encrypted, createdByClient is the api client which created it
+func (model walletModel) Store(body viewmodel.WalletEnableVM, ownedByIndex, createdByClient string) (res string, err error) {
 	sql := `INSERT INTO "wallet" (
-			"balance", "owned_by"
-		) VALUES($1, $2) RETURNING "id"`
-	err = model.DB.QueryRow(sql, body.WalletVM.Balance, body.WalletVM.OwnedBy).Scan(&res)
+			"balance", "owned_by", "owned_by_index", "created_by_client"
+		) VALUES($1, $2, $3, $4) RETURNING "id"`
+	if model.Tx != nil {
+		err = model.Tx.QueryRow(sql, body.WalletVM.Balance, body.WalletVM.OwnedBy, ownedByIndex, newNullString(createdByClient)).Scan(&res)
+	} else {
+		err = model.DB.QueryRow(sql, body.WalletVM.Balance, body.WalletVM.OwnedBy, ownedByIndex, newNullString(createdByClient)).Scan(&res)
+	}
 
 	return res, err
 }
 
-// Update ...
-func (model walletModel) Update(body viewmodel.WalletVM) (id string, balance int, err error) {
-	sql := `UPDATE "wallet" SET "status" = $1, "disabled_at" = $2, "enabled_at" = $3 WHERE "owned_by" = $4 RETURNING "id", "balance"`
-	err = model.DB.QueryRow(sql, body.Status, newNullString(body.DisabledAt), newNullString(body.EnabledAt), body.OwnedBy).Scan(&id, &balance)
+// Update set the status, any freeze of the wallet is lifted
+func (model walletModel) Update(ownedByIndex string, body viewmodel.WalletVM) (id string, balance int, err error) {
+	sql := `UPDATE "wallet" SET "status" = $1, "disabled_at" = $2, "enabled_at" = $3, "frozen_at" = NULL, "frozen_reason" = NULL,
+		"frozen_until" = NULL, "frozen_accepts_deposit" = false, "frozen_from" = NULL WHERE "owned_by_index" = $4 RETURNING "id", "balance"`
+	if model.Tx != nil {
+		err = model.Tx.QueryRow(sql, body.Status, newNullString(body.DisabledAt), newNullString(body.EnabledAt), ownedByIndex).Scan(&id, &balance)
+	} else {
+		err = model.DB.QueryRow(sql, body.Status, newNullString(body.DisabledAt), newNullString(body.EnabledAt), ownedByIndex).Scan(&id, &balance)
+	}
 
 	return id, balance, err
 }
 
-// MinusBalance ...
-func (model walletModel) MinusBalance(ownedBy string, amount int) (res string, err error) {
-	sql := `UPDATE "wallet" SET "balance" = "balance" - $1 WHERE "owned_by" = $2 RETURNING "id"`
+// Freeze set the frozen status, a frozen wallet is frozen again with the new reason and expiry
+func (model walletModel) Freeze(ownedByIndex string, body WalletFreezeEntity) (res string, err error) {
+	sql := `UPDATE "wallet" SET "status" = $1, "frozen_at" = now(), "frozen_reason" = $2, "frozen_until" = $3,
+		"frozen_accepts_deposit" = $4, "frozen_from" = $5 WHERE "owned_by_index" = $6 RETURNING "id"`
 	if model.Tx != nil {
-		err = model.Tx.QueryRow(sql, amount, ownedBy).Scan(&res)
+		err = model.Tx.QueryRow(sql, helper.StatusFrozen, body.Reason, newNullString(body.Until), body.AcceptsDeposit, newNullString(body.From), ownedByIndex).Scan(&res)
 	} else {
-		err = model.DB.QueryRow(sql, amount, ownedBy).Scan(&res)
+		err = model.DB.QueryRow(sql, helper.StatusFrozen, body.Reason, newNullString(body.Until), body.AcceptsDeposit, newNullString(body.From), ownedByIndex).Scan(&res)
 	}
 
 	return res, err
 }
 
-// PlusBalance ...
-func (model walletModel) PlusBalance(ownedBy string, amount int) (res string, err error) {
-	sql := `UPDATE "wallet" SET "balance" = "balance" + $1 WHERE "owned_by" = $2 RETURNING "id"`
+// Close set the terminal closed status, the wallet is retained for retentionYears from now
+func (model walletModel) Close(ownedByIndex, reason string, retentionYears int) (res string, err error) {
+	sql := `UPDATE "wallet" SET "status" = $1, "closed_at" = now(), "closed_reason" = $2, "retain_until" = now() + make_interval(years => $3),
+		"frozen_at" = NULL, "frozen_reason" = NULL, "frozen_until" = NULL, "frozen_accepts_deposit" = false, "frozen_from" = NULL,
+		"closing_payout_id" = NULL, "closing_reason" = NULL WHERE "owned_by_index" = $4 RETURNING "id"`
 	if model.Tx != nil {
-		fmt.Println("sampe sini")
-		err = model.Tx.QueryRow(sql, amount, ownedBy).Scan(&res)
+		err = model.Tx.QueryRow(sql, helper.StatusClosed, newNullString(reason), retentionYears, ownedByIndex).Scan(&res)
 	} else {
-		err = model.DB.QueryRow(sql, amount, ownedBy).Scan(&res)
+		err = model.DB.QueryRow(sql, helper.StatusClosed, newNullString(reason), retentionYears, ownedByIndex).Scan(&res)
+	}
+
+	return res, err
+}
+
+// StartClose wait for the payout withdrawal before closing the wallet, no other operation is accepted meanwhile
+func (model walletModel) StartClose(ownedByIndex, payoutID, reason string) (res string, err error) {
+	sql := `UPDATE "wallet" SET "closing_payout_id" = $1, "closing_reason" = $2 WHERE "owned_by_index" = $3 RETURNING "id"`
+	if model.Tx != nil {
+		err = model.Tx.QueryRow(sql, payoutID, newNullString(reason), ownedByIndex).Scan(&res)
+	} else {
+		err = model.DB.QueryRow(sql, payoutID, newNullString(reason), ownedByIndex).Scan(&res)
+	}
+
+	return res, err
+}
+
+// CancelClose the payout failed, the wallet accepts operations again
+func (model walletModel) CancelClose(ownedByIndex string) (res string, err error) {
+	sql := `UPDATE "wallet" SET "closing_payout_id" = NULL, "closing_reason" = NULL WHERE "owned_by_index" = $1 RETURNING "id"`
+	if model.Tx != nil {
+		err = model.Tx.QueryRow(sql, ownedByIndex).Scan(&res)
+	} else {
+		err = model.DB.QueryRow(sql, ownedByIndex).Scan(&res)
+	}
+
+	return res, err
+}
+
+// UpdateBalance store the balance derived from the ledger as the wallet cached balance
+func (model walletModel) UpdateBalance(ownedByIndex string, balance int) (res string, err error) {
+	sql := `UPDATE "wallet" SET "balance" = $1 WHERE "owned_by_index" = $2 RETURNING "id"`
+	if model.Tx != nil {
+		err = model.Tx.QueryRow(sql, balance, ownedByIndex).Scan(&res)
+	} else {
+		err = model.DB.QueryRow(sql, balance, ownedByIndex).Scan(&res)
+	}
+
+	return res, err
+}
+
+const walletStatusColumns = `"frozen_at", "frozen_reason", "frozen_until", "frozen_accepts_deposit", "frozen_from", "closed_at", "closed_reason", "retain_until",
+	"closing_payout_id", "closing_reason"`
+
+// AdoptLegacyOwner encrypt the owner of a wallet stored in plain before field encryption, the
+// wallet is only updated while it has no blind index so the migration and concurrent callers agree
+func (model walletModel) AdoptLegacyOwner(plainOwner, owner, ownedByIndex string) (res string, err error) {
+	sql := `UPDATE "wallet" SET "owned_by" = $1, "owned_by_index" = $2 WHERE "owned_by_index" IS NULL AND "owned_by" = $3 RETURNING "id"`
+	if model.Tx != nil {
+		err = model.Tx.QueryRow(sql, owner, ownedByIndex, plainOwner).Scan(&res)
+	} else {
+		err = model.DB.QueryRow(sql, owner, ownedByIndex, plainOwner).Scan(&res)
+	}
+	if err != nil && err.Error() == helper.SQLHandlerErrorRowNull {
+		return "", nil
 	}
 
 	return res, err
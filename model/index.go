@@ -2,8 +2,20 @@ package model
 
 import (
 	"database/sql"
+
+	"github.com/lib/pq"
 )
 
+// uniqueViolation postgres error code of a duplicate key
+const uniqueViolation = "23505"
+
+// IsUniqueViolation the statement was rejected by a unique index
+func IsUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+
+	return ok && pqErr.Code == uniqueViolation
+}
+
 // SQLGdbc ...
 type SQLGdbc interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
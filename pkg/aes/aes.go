@@ -3,12 +3,30 @@ package aes
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// VersionAAD prefix of the ciphertexts encrypted with AES-256-GCM and bound to where they are
+	// stored by their additional data, a ciphertext copied to another column or row does not decrypt
+	VersionAAD = "v2:"
+	// VersionGCM prefix of the AES-256-GCM ciphertexts without additional data, values without
+	// a prefix were encrypted with the legacy CFB mode. Both are only decrypted.
+	VersionGCM = "v1:"
+
+	// the info binds each derived key to its use
+	kdfInfo        = "julo-backend aes-256-gcm v1"
+	blindIndexInfo = "julo-backend blind index v1"
 )
 
 // Credential ...
@@ -16,7 +34,7 @@ type Credential struct {
 	Key string
 }
 
-// shaKey ...
+// shaKey legacy key of the CFB ciphertexts, only used to decrypt
 func (cred *Credential) shaKey() (res []byte) {
 	h := sha1.New()
 	h.Write([]byte(cred.Key))
@@ -26,67 +44,123 @@ func (cred *Credential) shaKey() (res []byte) {
 	return res
 }
 
-// Encrypt ...
-func (cred *Credential) Encrypt(textString string) (string, error) {
-	key := cred.shaKey()
-	text := []byte(textString)
+// deriveKey derive a 256 bits key bound to its use from the secret with HKDF-SHA256 (RFC 5869)
+func (cred *Credential) deriveKey(info string) []byte {
+	res := make([]byte, 32)
+	io.ReadFull(hkdf.New(sha256.New, []byte(cred.Key), nil, []byte(info)), res)
 
-	block, err := aes.NewCipher(key)
+	return res
+}
+
+// gcmKey ...
+func (cred *Credential) gcmKey() []byte {
+	return cred.deriveKey(kdfInfo)
+}
+
+// BlindIndex deterministic keyed hash of a value, encrypted values are looked up with it
+// since their ciphertext changes on every encryption
+func (cred *Credential) BlindIndex(value string) string {
+	h := hmac.New(sha256.New, cred.deriveKey(blindIndexInfo))
+	h.Write([]byte(value))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Encrypt encrypt with AES-256-GCM, aad names where the value is stored (the column, and the row
+// when it is known on both ends) and must be given again to decrypt it
+func (cred *Credential) Encrypt(textString, aad string) (string, error) {
+	gcm, err := cred.gcm()
 	if err != nil {
 		return "", err
 	}
-	b := base64.StdEncoding.EncodeToString(text)
-	ciphertext := make([]byte, aes.BlockSize+len(b))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", err
 	}
-	cfb := cipher.NewCFBEncrypter(block, iv)
-	cfb.XORKeyStream(ciphertext[aes.BlockSize:], []byte(b))
+	ciphertext := gcm.Seal(nonce, nonce, []byte(textString), []byte(aad))
 
-	res := hex.EncodeToString(ciphertext)
+	res := VersionAAD + hex.EncodeToString(ciphertext)
 	return res, nil
 }
 
 // EncryptNoErr ...
-func (cred *Credential) EncryptNoErr(textString string) string {
-	key := cred.shaKey()
-	text := []byte(textString)
-
-	block, err := aes.NewCipher(key)
+func (cred *Credential) EncryptNoErr(textString, aad string) string {
+	res, err := cred.Encrypt(textString, aad)
 	if err != nil {
 		return ""
 	}
-	b := base64.StdEncoding.EncodeToString(text)
-	ciphertext := make([]byte, aes.BlockSize+len(b))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+
+	return res
+}
+
+// Decrypt a value of any version, aad is ignored by the versions which had none
+func (cred *Credential) Decrypt(text, aad string) (string, error) {
+	if strings.HasPrefix(text, VersionAAD) {
+		return cred.decryptGCM(strings.TrimPrefix(text, VersionAAD), []byte(aad))
+	}
+	if strings.HasPrefix(text, VersionGCM) {
+		return cred.decryptGCM(strings.TrimPrefix(text, VersionGCM), nil)
+	}
+
+	return cred.decryptCFB(text)
+}
+
+// DecryptNoErr ...
+func (cred *Credential) DecryptNoErr(text, aad string) string {
+	res, err := cred.Decrypt(text, aad)
+	if err != nil {
 		return ""
 	}
-	cfb := cipher.NewCFBEncrypter(block, iv)
-	cfb.XORKeyStream(ciphertext[aes.BlockSize:], []byte(b))
 
-	res := hex.EncodeToString(ciphertext)
 	return res
 }
 
-// Decrypt ...
-func (cred *Credential) Decrypt(text string) (string, error) {
-	key := cred.shaKey()
-	ciphertext, _ := hex.DecodeString(text)
+// IsCurrent check the value is encrypted with the current version
+func (cred *Credential) IsCurrent(text string) bool {
+	return strings.HasPrefix(text, VersionAAD)
+}
 
-	block, err := aes.NewCipher(key)
+// Reencrypt migrate a stored value to the current version bound to aad, current values are returned as is
+func (cred *Credential) Reencrypt(text, aad string) (string, error) {
+	if cred.IsCurrent(text) {
+		return text, nil
+	}
+
+	plain, err := cred.Decrypt(text, aad)
 	if err != nil {
 		return "", err
 	}
-	if len(ciphertext) < aes.BlockSize {
+
+	return cred.Encrypt(plain, aad)
+}
+
+// gcm the AES-256-GCM cipher of the derived key
+func (cred *Credential) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(cred.gcmKey())
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (cred *Credential) decryptGCM(text string, aad []byte) (string, error) {
+	ciphertext, err := hex.DecodeString(text)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := cred.gcm()
+	if err != nil {
+		return "", err
+	}
+	if len(ciphertext) < gcm.NonceSize()+gcm.Overhead() {
 		return "", errors.New("ciphertext too short")
 	}
-	iv := ciphertext[:aes.BlockSize]
-	ciphertext = ciphertext[aes.BlockSize:]
-	cfb := cipher.NewCFBDecrypter(block, iv)
-	cfb.XORKeyStream(ciphertext, ciphertext)
-	data, err := base64.StdEncoding.DecodeString(string(ciphertext))
+
+	nonce := ciphertext[:gcm.NonceSize()]
+	data, err := gcm.Open(nil, nonce, ciphertext[gcm.NonceSize():], aad)
 	if err != nil {
 		return "", err
 	}
@@ -95,17 +169,20 @@ func (cred *Credential) Decrypt(text string) (string, error) {
 	return res, nil
 }
 
-// DecryptNoErr ...
-func (cred *Credential) DecryptNoErr(text string) string {
+// decryptCFB decrypt the legacy unauthenticated ciphertexts, they are no longer produced
+func (cred *Credential) decryptCFB(text string) (string, error) {
 	key := cred.shaKey()
-	ciphertext, _ := hex.DecodeString(text)
+	ciphertext, err := hex.DecodeString(text)
+	if err != nil {
+		return "", err
+	}
 
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return ""
+		return "", err
 	}
 	if len(ciphertext) < aes.BlockSize {
-		return ""
+		return "", errors.New("ciphertext too short")
 	}
 	iv := ciphertext[:aes.BlockSize]
 	ciphertext = ciphertext[aes.BlockSize:]
@@ -113,9 +190,9 @@ func (cred *Credential) DecryptNoErr(text string) string {
 	cfb.XORKeyStream(ciphertext, ciphertext)
 	data, err := base64.StdEncoding.DecodeString(string(ciphertext))
 	if err != nil {
-		return ""
+		return "", err
 	}
 
 	res := string(data[:])
-	return res
+	return res, nil
 }
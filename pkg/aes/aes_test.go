@@ -0,0 +1,137 @@
+package aes
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+)
+
+const (
+	testKey   = "goinitsecret32bitsupersecret"
+	testPlain = "ea0212d3-abd6-406f-8c67-868e814a2436"
+	testAAD   = "wallet.owned_by"
+)
+
+// encryptCFB encrypt the way the legacy version did
+func encryptCFB(t *testing.T, cred *Credential, text string) string {
+	block, err := aes.NewCipher(cred.shaKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := base64.StdEncoding.EncodeToString([]byte(text))
+	ciphertext := make([]byte, aes.BlockSize+len(b))
+	iv := ciphertext[:aes.BlockSize]
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		t.Fatal(err)
+	}
+	cipher.NewCFBEncrypter(block, iv).XORKeyStream(ciphertext[aes.BlockSize:], []byte(b))
+
+	return hex.EncodeToString(ciphertext)
+}
+
+// encryptV1 encrypt the way the GCM version without additional data did
+func encryptV1(t *testing.T, cred *Credential, text string) string {
+	gcm, err := cred.gcm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		t.Fatal(err)
+	}
+
+	return VersionGCM + hex.EncodeToString(gcm.Seal(nonce, nonce, []byte(text), nil))
+}
+
+func TestEncrypt(t *testing.T) {
+	cred := &Credential{Key: testKey}
+	ciphertext, err := cred.Encrypt(testPlain, testAAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(ciphertext, VersionAAD) || !cred.IsCurrent(ciphertext) {
+		t.Errorf("ciphertext %s is not of the current version", ciphertext)
+	}
+
+	// The nonce is random
+	again, _ := cred.Encrypt(testPlain, testAAD)
+	if again == ciphertext {
+		t.Error("same ciphertext twice")
+	}
+
+	plain, err := cred.Decrypt(ciphertext, testAAD)
+	if err != nil || plain != testPlain {
+		t.Errorf("decrypt %q, %v", plain, err)
+	}
+
+	// A ciphertext is bound to its additional data and key
+	if _, err := cred.Decrypt(ciphertext, "balance.deposited_by"); err == nil {
+		t.Error("decrypted with another additional data")
+	}
+	other := &Credential{Key: testKey + "x"}
+	if _, err := other.Decrypt(ciphertext, testAAD); err == nil {
+		t.Error("decrypted with another key")
+	}
+	if cred.DecryptNoErr(ciphertext[:len(ciphertext)-2], testAAD) != "" {
+		t.Error("decrypted a truncated ciphertext")
+	}
+}
+
+func TestDecryptLegacy(t *testing.T) {
+	cred := &Credential{Key: testKey}
+
+	tests := []struct {
+		name       string
+		ciphertext string
+	}{
+		{name: "cfb", ciphertext: encryptCFB(t, cred, testPlain)},
+		{name: "v1", ciphertext: encryptV1(t, cred, testPlain)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cred.IsCurrent(tt.ciphertext) {
+				t.Error("legacy ciphertext reported current")
+			}
+
+			// The additional data is ignored by the versions which had none
+			plain, err := cred.Decrypt(tt.ciphertext, testAAD)
+			if err != nil || plain != testPlain {
+				t.Fatalf("decrypt %q, %v", plain, err)
+			}
+
+			res, err := cred.Reencrypt(tt.ciphertext, testAAD)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cred.IsCurrent(res) {
+				t.Errorf("reencrypted %s is not of the current version", res)
+			}
+			if plain, err := cred.Decrypt(res, testAAD); err != nil || plain != testPlain {
+				t.Errorf("decrypt reencrypted %q, %v", plain, err)
+			}
+
+			// A current value is kept as is
+			if same, err := cred.Reencrypt(res, testAAD); err != nil || same != res {
+				t.Errorf("reencrypt current %s, %v", same, err)
+			}
+		})
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	cred := &Credential{Key: testKey}
+
+	// The indexes stored in the database must not change with the key derivation
+	const want = "9ffac7a4e734b337659d79089b51959f62e59ec4a6650882c20ec5f26c16663c"
+	if res := cred.BlindIndex(testPlain); res != want {
+		t.Errorf("blind index %s, want %s", res, want)
+	}
+	if cred.BlindIndex(strings.ToUpper(testPlain)) == want {
+		t.Error("blind index does not depend on the value")
+	}
+}
@@ -11,7 +11,7 @@ type IQueue interface {
 	PushQueue(data map[string]interface{}, types string) error
 	PushQueueReconnect(url string, data map[string]interface{}, types, deadLetterKey string) (*amqp.Connection, *amqp.Channel, error)
 	PushDLQueueReconnect(url string, data map[string]interface{}, types string) (*amqp.Connection, *amqp.Channel, error)
-	PushQueueDelayReconnect(url string, data map[string]interface{}, delayedKey, incomingKey, deadLetterKey string, ttl int64) (*amqp.Connection, *amqp.Channel, error)
+	PushQueueDelayReconnect(url string, data map[string]interface{}, headers amqp.Table, delayedKey, incomingKey, deadLetterKey string, ttl int64) (*amqp.Connection, *amqp.Channel, error)
 }
 
 var (
@@ -21,6 +21,8 @@ var (
 	UpdateBalance = "update_balance.incoming.queue"
 	// UpdateBalanceDeadLetter ...
 	UpdateBalanceDeadLetter = "update_balance.deadletter.queue"
+	// UpdateBalanceDelay prefix of the delay queues, suffixed by the ttl in milliseconds
+	UpdateBalanceDelay = "update_balance.delay"
 )
 
 // queue ...
@@ -153,8 +155,9 @@ func (m queue) PushDLQueueReconnect(url string, data map[string]interface{}, typ
 	return m.Connection, m.Channel, err
 }
 
-// PushQueueDelayReconnect ...
-func (m queue) PushQueueDelayReconnect(url string, data map[string]interface{}, delayedKey, incomingKey, deadLetterKey string, ttl int64) (*amqp.Connection, *amqp.Channel, error) {
+// PushQueueDelayReconnect publish to a delayed queue which dead-letters the message to the incoming queue
+// once the ttl expires, the delayed queue should be named after its ttl as queue arguments can not change
+func (m queue) PushQueueDelayReconnect(url string, data map[string]interface{}, headers amqp.Table, delayedKey, incomingKey, deadLetterKey string, ttl int64) (*amqp.Connection, *amqp.Channel, error) {
 	if m.Connection != nil {
 		if m.Connection.IsClosed() {
 			c := Connection{
@@ -179,7 +182,6 @@ func (m queue) PushQueueDelayReconnect(url string, data map[string]interface{},
 		m.Channel = newChannel
 	}
 
-	m.Channel.QueueDelete(delayedKey, false, false, false)
 	args := amqp.Table{
 		"x-message-ttl":             ttl,
 		"x-dead-letter-exchange":    "",
@@ -205,6 +207,7 @@ func (m queue) PushQueueDelayReconnect(url string, data map[string]interface{},
 	}
 
 	err = m.Channel.Publish("", queue.Name, false, false, amqp.Publishing{
+		Headers:      headers,
 		DeliveryMode: amqp.Persistent,
 		ContentType:  "text/plain",
 		Body:         body,
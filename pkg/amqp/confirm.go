@@ -0,0 +1,151 @@
+package amqp
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+var (
+	// ErrNack the broker refused the message
+	ErrNack = errors.New("message nacked by the broker")
+	// ErrConfirmTimeout the broker did not confirm the message in time, it may still have been queued
+	ErrConfirmTimeout = errors.New("publisher confirm timeout")
+)
+
+// ConfirmQueue publish on a channel in confirm mode, a push returns once the broker has taken
+// the message. It reconnects after the connection was closed and is not safe for concurrent use.
+type ConfirmQueue struct {
+	URL     string
+	Timeout time.Duration
+
+	connection *amqp.Connection
+	channel    *amqp.Channel
+	confirms   chan amqp.Confirmation
+}
+
+// connect open a connection and put its channel in confirm mode
+func (m *ConfirmQueue) connect() (err error) {
+	if m.connection != nil && !m.connection.IsClosed() {
+		return nil
+	}
+
+	c := Connection{
+		URL: m.URL,
+	}
+	m.connection, m.channel, err = c.Connect()
+	if err != nil {
+		m.Close()
+		return err
+	}
+	err = m.channel.Confirm(false)
+	if err != nil {
+		m.Close()
+		return err
+	}
+	m.confirms = m.channel.NotifyPublish(make(chan amqp.Confirmation, 1))
+
+	return nil
+}
+
+// Close close the connection, the next push opens a new one
+func (m *ConfirmQueue) Close() {
+	if m.connection != nil {
+		m.connection.Close()
+	}
+	m.connection, m.channel, m.confirms = nil, nil, nil
+}
+
+// PushQueueReconnect publish to the queue declared with its dead letter queue and wait for the broker confirm
+func (m *ConfirmQueue) PushQueueReconnect(data map[string]interface{}, types, deadLetterKey string) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	err = m.connect()
+	if err != nil {
+		return err
+	}
+
+	args := amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": deadLetterKey,
+	}
+	queue, err := m.channel.QueueDeclare(types, true, false, false, false, args)
+	if err != nil {
+		m.Close()
+		return err
+	}
+
+	return m.publish(queue.Name, nil, body)
+}
+
+// PushQueueDelayReconnect publish to a delayed queue which dead-letters the message to the incoming queue
+// once the ttl expires and wait for the broker confirm, see queue.PushQueueDelayReconnect
+func (m *ConfirmQueue) PushQueueDelayReconnect(data map[string]interface{}, headers amqp.Table, delayedKey, incomingKey, deadLetterKey string, ttl int64) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	err = m.connect()
+	if err != nil {
+		return err
+	}
+
+	args := amqp.Table{
+		"x-message-ttl":             ttl,
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": incomingKey,
+	}
+	queue, err := m.channel.QueueDeclare(delayedKey, true, false, false, false, args)
+	if err != nil {
+		m.Close()
+		return err
+	}
+
+	args = amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": deadLetterKey,
+	}
+	_, err = m.channel.QueueDeclare(incomingKey, true, false, false, false, args)
+	if err != nil {
+		m.Close()
+		return err
+	}
+
+	return m.publish(queue.Name, headers, body)
+}
+
+// publish a persistent message and wait for its confirm
+func (m *ConfirmQueue) publish(queueName string, headers amqp.Table, body []byte) error {
+	err := m.channel.Publish("", queueName, false, false, amqp.Publishing{
+		Headers:      headers,
+		DeliveryMode: amqp.Persistent,
+		ContentType:  "text/plain",
+		Body:         body,
+	})
+	if err != nil {
+		m.Close()
+		return err
+	}
+
+	select {
+	case confirm, ok := <-m.confirms:
+		if !ok {
+			m.Close()
+			return amqp.ErrClosed
+		}
+		if !confirm.Ack {
+			return ErrNack
+		}
+		return nil
+	case <-time.After(m.Timeout):
+		// A late confirm would be taken for the next message, start over on a new channel
+		m.Close()
+		return ErrConfirmTimeout
+	}
+}
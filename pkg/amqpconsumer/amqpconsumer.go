@@ -28,14 +28,38 @@ type Consumer struct {
 	bindingKey   string // routing key that we are using
 }
 
-// FailCounter ...
-type FailCounter struct {
-	Counter int
-}
-
 // MaxFailCounter ...
 var MaxFailCounter = 3
 
+// AttemptHeader header carrying how many times a message has been retried
+var AttemptHeader = "x-attempt"
+
+// BaseRetryDelay delay in milliseconds before the first retry, doubled on every attempt
+var BaseRetryDelay int64 = 2000
+
+// Attempt read the retry attempt of a delivery from its headers
+func Attempt(d amqp.Delivery) int {
+	switch v := d.Headers[AttemptHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+
+	return 0
+}
+
+// RetryDelay delay in milliseconds before the given attempt is delivered again
+func RetryDelay(attempt int) int64 {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	return BaseRetryDelay << uint(attempt-1)
+}
+
 // NewConsumer returns a Consumer struct
 // that has been initialized properly
 // essentially don't touch conn, channel, or
@@ -228,3 +252,36 @@ func (c *Consumer) Handle(
 		log.Println("Reconnected... possibly")
 	}
 }
+
+// Browse fetch up to limit messages from a queue without consuming it, fn is called
+// for every message and returns true when it has settled (acked or rejected) the
+// message itself, the remaining messages are put back on the queue once browsing
+// is done so each message is seen only once
+func (c *Consumer) Browse(queueName string, limit int, fn func(d amqp.Delivery) (bool, error)) error {
+	var held []amqp.Delivery
+	defer func() {
+		for _, d := range held {
+			d.Nack(false, true)
+		}
+	}()
+
+	for i := 0; i < limit; i++ {
+		d, ok, err := c.channel.Get(queueName, false)
+		if err != nil {
+			return fmt.Errorf("Queue Get: %s", err)
+		}
+		if !ok {
+			return nil
+		}
+
+		settled, err := fn(d)
+		if !settled {
+			held = append(held, d)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
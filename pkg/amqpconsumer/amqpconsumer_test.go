@@ -0,0 +1,49 @@
+package amqpconsumer
+
+import (
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+func TestAttempt(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    int
+	}{
+		{name: "first delivery"},
+		{name: "other headers", headers: amqp.Table{"x-death": []interface{}{}}},
+		// The broker hands the integers back as int32 or int64 depending on their size
+		{name: "int32", headers: amqp.Table{AttemptHeader: int32(2)}, want: 2},
+		{name: "int64", headers: amqp.Table{AttemptHeader: int64(3)}, want: 3},
+		{name: "int", headers: amqp.Table{AttemptHeader: 1}, want: 1},
+		{name: "string", headers: amqp.Table{AttemptHeader: "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := Attempt(amqp.Delivery{Headers: tt.headers}); res != tt.want {
+				t.Errorf("attempt %d, want %d", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    int64
+	}{
+		{attempt: -1, want: BaseRetryDelay},
+		{attempt: 0, want: BaseRetryDelay},
+		{attempt: 1, want: BaseRetryDelay},
+		{attempt: 2, want: 2 * BaseRetryDelay},
+		{attempt: 3, want: 4 * BaseRetryDelay},
+		{attempt: MaxFailCounter, want: BaseRetryDelay << uint(MaxFailCounter-1)},
+	}
+	for _, tt := range tests {
+		if res := RetryDelay(tt.attempt); res != tt.want {
+			t.Errorf("attempt %d: delay %d, want %d", tt.attempt, res, tt.want)
+		}
+	}
+}
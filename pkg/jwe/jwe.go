@@ -1,23 +1,111 @@
 package jwe
 
 import (
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"encoding/json"
+	"errors"
+	"time"
+
+	"julo-backend/pkg/logruslogger"
 
 	"github.com/lestrrat/go-jwx/jwa"
 	"github.com/lestrrat/go-jwx/jwe"
 )
 
+const (
+	// AlgorithmRSAOAEP256 wrap the content key with an RSA key
+	AlgorithmRSAOAEP256 = string(jwa.RSA_OAEP_256)
+	// AlgorithmECDHES wrap the content key with a key agreed with a P-256 key
+	AlgorithmECDHES = string(jwa.ECDH_ES_A256KW)
+)
+
+// decryptAlgorithms accepted when decrypting, RSA1_5 is only accepted until the LegacyUntil sunset
+var decryptAlgorithms = map[jwa.KeyEncryptionAlgorithm]bool{
+	jwa.RSA_OAEP_256:   true,
+	jwa.ECDH_ES_A256KW: true,
+}
+
 // Credential ...
 type Credential struct {
 	KeyLocation string
 	Passphrase  string
+	Algorithm   string
+	Keyring     *Keyring
+	// LegacyUntil RFC3339 sunset of the RSA1_5 tokens issued before the algorithm was configurable,
+	// empty to reject them. RSA1_5 is open to padding oracle attacks and is never used to encrypt.
+	LegacyUntil string
+	legacyUntil time.Time
 }
 
-// Generate ...
-func (cred *Credential) Generate(payload map[string]interface{}) (res string, err error) {
-	privkey, err := rsaConfigSetup(cred.KeyLocation, cred.Passphrase)
+// Load read the keyring once, it must be called before the credential is used
+func (cred *Credential) Load() (err error) {
+	if cred.Algorithm == "" {
+		cred.Algorithm = AlgorithmRSAOAEP256
+	}
+	if cred.Algorithm != AlgorithmRSAOAEP256 && cred.Algorithm != AlgorithmECDHES {
+		return errors.New("Unsupported JWE algorithm " + cred.Algorithm)
+	}
+
+	if cred.LegacyUntil != "" {
+		cred.legacyUntil, err = time.Parse(time.RFC3339, cred.LegacyUntil)
+		if err != nil {
+			return errors.New("Invalid RSA1_5 sunset " + cred.LegacyUntil)
+		}
+	}
+
+	cred.Keyring, err = LoadKeyring(cred.KeyLocation, cred.Passphrase)
 	if err != nil {
-		return res, err
+		return err
+	}
+
+	// Fail at startup rather than on the first token if the active key does not fit the algorithm
+	_, _, err = cred.keyEncrypter(cred.Keyring.Active())
+
+	return err
+}
+
+// keyEncrypter build the content key encrypter of the configured algorithm for the key
+func (cred *Credential) keyEncrypter(key *Key) (res jwe.KeyEncrypter, keysize int, err error) {
+	contentCrypt, err := jwe.NewAesCrypt(jwa.A256GCM)
+	if err != nil {
+		return res, keysize, err
+	}
+
+	switch cred.Algorithm {
+	case AlgorithmRSAOAEP256:
+		publicKey, ok := key.PrivateKey.Public().(*rsa.PublicKey)
+		if !ok {
+			return res, keysize, errors.New(cred.Algorithm + " requires an RSA key, " + key.ID + " is not")
+		}
+		keyEncrypt, err := jwe.NewRSAOAEPKeyEncrypt(jwa.RSA_OAEP_256, publicKey)
+		if err != nil {
+			return res, keysize, err
+		}
+		keyEncrypt.KeyID = key.ID
+
+		return keyEncrypt, contentCrypt.KeySize() / 2, err
+	case AlgorithmECDHES:
+		publicKey, ok := key.PrivateKey.Public().(*ecdsa.PublicKey)
+		if !ok {
+			return res, keysize, errors.New(cred.Algorithm + " requires an EC key, " + key.ID + " is not")
+		}
+		keyEncrypt, err := jwe.NewEcdhesKeyWrapEncrypt(jwa.ECDH_ES_A256KW, publicKey)
+		if err != nil {
+			return res, keysize, err
+		}
+		keyEncrypt.KeyID = key.ID
+
+		return keyEncrypt, contentCrypt.KeySize() / 2, err
+	}
+
+	return res, keysize, errors.New("Unsupported JWE algorithm " + cred.Algorithm)
+}
+
+// Generate encrypt the payload with the active key, the kid header tells which key to decrypt with
+func (cred *Credential) Generate(payload map[string]interface{}) (res string, err error) {
+	if cred.Keyring == nil {
+		return res, errors.New("JWE keyring is not loaded")
 	}
 
 	// Convert payload to string
@@ -26,21 +114,66 @@ func (cred *Credential) Generate(payload map[string]interface{}) (res string, er
 		return res, err
 	}
 
+	contentCrypt, err := jwe.NewAesCrypt(jwa.A256GCM)
+	if err != nil {
+		return res, err
+	}
+	keyEncrypt, keysize, err := cred.keyEncrypter(cred.Keyring.Active())
+	if err != nil {
+		return res, err
+	}
+
 	// Generate JWE
-	jweRes, err := jwe.Encrypt([]byte(payloadString), jwa.RSA1_5, &privkey.PublicKey, jwa.A128CBC_HS256, jwa.Deflate)
+	msg, err := jwe.NewMultiEncrypt(contentCrypt, jwe.NewRandomKeyGenerate(keysize), keyEncrypt).Encrypt(payloadString)
+	if err != nil {
+		return res, err
+	}
+	jweRes, err := jwe.CompactSerialize{}.Serialize(msg)
 	res = string(jweRes)
 
 	return res, err
 }
 
-// Rollback ...
+// Rollback decrypt the payload with the key named by its kid, tokens without a kid
+// were issued before the keyring and are tried against every key
 func (cred *Credential) Rollback(userID string) (res map[string]interface{}, err error) {
-	privkey, err := rsaConfigSetup(cred.KeyLocation, cred.Passphrase)
+	if cred.Keyring == nil {
+		return res, errors.New("JWE keyring is not loaded")
+	}
+
+	msg, err := jwe.Parse([]byte(userID))
 	if err != nil {
 		return res, err
 	}
+	if len(msg.Recipients) != 1 {
+		return res, errors.New("Unexpected number of recipients")
+	}
+	alg := msg.Recipients[0].Header.Algorithm
+	if alg == jwa.RSA1_5 {
+		if !time.Now().Before(cred.legacyUntil) {
+			return res, errors.New("Unsupported JWE algorithm " + alg.String())
+		}
+		logruslogger.Log(logruslogger.WarnLevel, msg.Recipients[0].Header.KeyID, "jwe.Rollback", "legacy_rsa1_5", "")
+	} else if !decryptAlgorithms[alg] {
+		return res, errors.New("Unsupported JWE algorithm " + alg.String())
+	}
 
-	decrypted, err := jwe.Decrypt([]byte(userID), jwa.RSA1_5, privkey)
+	keys := cred.Keyring.Keys()
+	if kid := msg.Recipients[0].Header.KeyID; kid != "" {
+		key, ok := cred.Keyring.Find(kid)
+		if !ok {
+			return res, errors.New("Unknown or retired key " + kid)
+		}
+		keys = []*Key{key}
+	}
+
+	var decrypted []byte
+	for _, key := range keys {
+		decrypted, err = msg.Decrypt(alg, key.PrivateKey)
+		if err == nil {
+			break
+		}
+	}
 	if err != nil {
 		return res, err
 	}
@@ -0,0 +1,154 @@
+package jwe
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat/go-jwx/jwa"
+	"github.com/lestrrat/go-jwx/jwe"
+)
+
+// testLegacyToken encrypt the payload with RSA1_5 the way the tokens were issued before the algorithm was configurable
+func testLegacyToken(t *testing.T, key *Key, payload map[string]interface{}) string {
+	b, _ := json.Marshal(payload)
+	contentCrypt, err := jwe.NewAesCrypt(jwa.A256GCM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyEncrypt, err := jwe.NewRSAPKCSKeyEncrypt(jwa.RSA1_5, key.PrivateKey.Public().(*rsa.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyEncrypt.KeyID = key.ID
+	msg, err := jwe.NewMultiEncrypt(contentCrypt, jwe.NewRandomKeyGenerate(contentCrypt.KeySize()/2), keyEncrypt).Encrypt(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := jwe.CompactSerialize{}.Serialize(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(res)
+}
+
+func TestRollbackLegacyRSA15(t *testing.T) {
+	rsaKey, err := GenRSA(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := testKeyDir(t, map[string]crypto.Signer{"rsa.pem": rsaKey})
+	defer os.RemoveAll(dir)
+	location := testManifest(t, dir, KeyEntry{ID: "k1", File: "rsa.pem", Status: StatusActive})
+
+	payload := map[string]interface{}{"customerx_id": "ea0212d3-abd6-406f-8c67-868e814a2436"}
+	tests := []struct {
+		name        string
+		legacyUntil string
+		accepted    bool
+	}{
+		{name: "before the sunset", legacyUntil: time.Now().Add(time.Hour).Format(time.RFC3339), accepted: true},
+		{name: "after the sunset", legacyUntil: time.Now().Add(-time.Hour).Format(time.RFC3339)},
+		{name: "no sunset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cred := &Credential{KeyLocation: location, Passphrase: "passphrase", LegacyUntil: tt.legacyUntil}
+			if err := cred.Load(); err != nil {
+				t.Fatal(err)
+			}
+			token := testLegacyToken(t, cred.Keyring.Active(), payload)
+
+			res, err := cred.Rollback(token)
+			if !tt.accepted {
+				if err == nil || !strings.Contains(err.Error(), "RSA1_5") {
+					t.Errorf("error %v, want RSA1_5 rejected", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res["customerx_id"] != payload["customerx_id"] {
+				t.Errorf("payload %v, want %v", res, payload)
+			}
+
+			// RSA1_5 is never used to encrypt
+			token, err = cred.Generate(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg, err := jwe.Parse([]byte(token))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if alg := msg.Recipients[0].Header.Algorithm; alg != jwa.RSA_OAEP_256 {
+				t.Errorf("algorithm %s, want %s", alg, jwa.RSA_OAEP_256)
+			}
+		})
+	}
+
+	cred := &Credential{KeyLocation: location, Passphrase: "passphrase", LegacyUntil: "2026-12-31"}
+	if err := cred.Load(); err == nil {
+		t.Error("loaded a sunset which is not RFC3339")
+	}
+}
+
+func TestAlgorithms(t *testing.T) {
+	rsaKey, err := GenRSA(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := GenEC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := testKeyDir(t, map[string]crypto.Signer{"rsa.pem": rsaKey, "ec.pem": ecKey})
+	defer os.RemoveAll(dir)
+
+	payload := map[string]interface{}{"customerx_id": "ea0212d3-abd6-406f-8c67-868e814a2436"}
+	tests := []struct {
+		algorithm string
+		file      string
+		err       string
+	}{
+		{algorithm: AlgorithmRSAOAEP256, file: "rsa.pem"},
+		{algorithm: AlgorithmECDHES, file: "ec.pem"},
+		{algorithm: AlgorithmRSAOAEP256, file: "ec.pem", err: "requires an RSA key"},
+		{algorithm: AlgorithmECDHES, file: "rsa.pem", err: "requires an EC key"},
+		{algorithm: string(jwa.RSA1_5), file: "rsa.pem", err: "Unsupported JWE algorithm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm+" "+tt.file, func(t *testing.T) {
+			cred := &Credential{KeyLocation: filepath.Join(dir, tt.file), Passphrase: "passphrase", Algorithm: tt.algorithm}
+			err := cred.Load()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("error %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := cred.Generate(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := cred.Rollback(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res["customerx_id"] != payload["customerx_id"] {
+				t.Errorf("payload %v, want %v", res, payload)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package jwe
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// StatusActive the key used to encrypt, only one key can be active
+	StatusActive = "active"
+	// StatusDecrypt the key is only used to decrypt tokens issued before a rotation
+	StatusDecrypt = "decrypt"
+	// StatusRetired the key is kept in the manifest but no longer accepted
+	StatusRetired = "retired"
+)
+
+// KeyEntry entry of the keyring manifest, the file is relative to the manifest
+type KeyEntry struct {
+	ID        string `json:"kid"`
+	File      string `json:"file"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Manifest ...
+type Manifest struct {
+	Keys []KeyEntry `json:"keys"`
+}
+
+// Key ...
+type Key struct {
+	ID         string
+	Status     string
+	PrivateKey crypto.Signer
+}
+
+// Keyring set of keys identified by kid
+type Keyring struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+// LoadKeyring load a keyring from a json manifest, a single PEM file is loaded as a keyring
+// of one active key identified by its thumbprint. Every key of the manifest except the
+// retired ones must be readable.
+func LoadKeyring(location, passphrase string) (*Keyring, error) {
+	ring := &Keyring{keys: map[string]*Key{}}
+	if !strings.HasSuffix(location, ".json") {
+		privateKey, err := keyConfigSetup(location, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		ring.active = &Key{ID: Thumbprint(privateKey), Status: StatusActive, PrivateKey: privateKey}
+		ring.keys[ring.active.ID] = ring.active
+
+		return ring, nil
+	}
+
+	manifest, err := ReadManifest(location)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range manifest.Keys {
+		if entry.Status == StatusRetired {
+			continue
+		}
+		if entry.Status != StatusActive && entry.Status != StatusDecrypt {
+			return nil, fmt.Errorf("Key %s has an unknown status %s", entry.ID, entry.Status)
+		}
+
+		privateKey, err := keyConfigSetup(filepath.Join(filepath.Dir(location), entry.File), passphrase)
+		if err != nil {
+			return nil, err
+		}
+		key := &Key{ID: entry.ID, Status: entry.Status, PrivateKey: privateKey}
+		ring.keys[key.ID] = key
+		if key.Status == StatusActive {
+			if ring.active != nil {
+				return nil, errors.New("Keyring has more than one active key")
+			}
+			ring.active = key
+		}
+	}
+	if ring.active == nil {
+		return nil, errors.New("Keyring has no active key")
+	}
+
+	return ring, nil
+}
+
+// Active the key used to encrypt
+func (ring *Keyring) Active() *Key {
+	return ring.active
+}
+
+// Find a non retired key by kid
+func (ring *Keyring) Find(kid string) (*Key, bool) {
+	key, ok := ring.keys[kid]
+	return key, ok
+}
+
+// Keys every non retired key
+func (ring *Keyring) Keys() []*Key {
+	res := []*Key{}
+	for _, key := range ring.keys {
+		res = append(res, key)
+	}
+
+	return res
+}
+
+// Thumbprint short identifier derived from the public key
+func Thumbprint(key crypto.Signer) string {
+	var b []byte
+	if publicKey, ok := key.Public().(*rsa.PublicKey); ok {
+		b = x509.MarshalPKCS1PublicKey(publicKey)
+	} else {
+		b, _ = x509.MarshalPKIXPublicKey(key.Public())
+	}
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// ReadManifest ...
+func ReadManifest(location string) (res Manifest, err error) {
+	b, err := ioutil.ReadFile(location)
+	if err != nil {
+		return res, fmt.Errorf("Unable to read keyring %s: %s", location, err)
+	}
+	err = json.Unmarshal(b, &res)
+	if err != nil {
+		return res, fmt.Errorf("Unable to parse keyring %s: %s", location, err)
+	}
+
+	return res, err
+}
+
+// WriteManifest ...
+func WriteManifest(location string, manifest Manifest) error {
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(location, b, 0600)
+}
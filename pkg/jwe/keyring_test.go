@@ -0,0 +1,188 @@
+package jwe
+
+import (
+	"crypto"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testKeyDir write the keys in a temporary directory, keys of a nil value are not written
+func testKeyDir(t *testing.T, keys map[string]crypto.Signer) string {
+	dir, err := ioutil.TempDir("", "keyring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, key := range keys {
+		if key == nil {
+			continue
+		}
+		b, err := EncodeKey(key, "passphrase")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(filepath.Join(dir, name), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func testManifest(t *testing.T, dir string, entries ...KeyEntry) string {
+	location := filepath.Join(dir, "keyring.json")
+	if err := WriteManifest(location, Manifest{Keys: entries}); err != nil {
+		t.Fatal(err)
+	}
+
+	return location
+}
+
+func TestLoadKeyring(t *testing.T) {
+	oldKey, err := GenRSA(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := GenRSA(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := testKeyDir(t, map[string]crypto.Signer{"old.pem": oldKey, "new.pem": newKey})
+	defer os.RemoveAll(dir)
+
+	// A retired key is not read, its file may be gone
+	location := testManifest(t, dir,
+		KeyEntry{ID: "k0", File: "gone.pem", Status: StatusRetired},
+		KeyEntry{ID: "k1", File: "old.pem", Status: StatusDecrypt},
+		KeyEntry{ID: "k2", File: "new.pem", Status: StatusActive},
+	)
+	ring, err := LoadKeyring(location, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ring.Active().ID != "k2" {
+		t.Errorf("active %s, want k2", ring.Active().ID)
+	}
+	if _, ok := ring.Find("k0"); ok {
+		t.Error("retired key found")
+	}
+	if key, ok := ring.Find("k1"); !ok || key.Status != StatusDecrypt {
+		t.Errorf("key k1 %+v, %v", key, ok)
+	}
+	if len(ring.Keys()) != 2 {
+		t.Errorf("%d keys, want 2", len(ring.Keys()))
+	}
+
+	// A single PEM file is a keyring of one active key named by its thumbprint
+	ring, err = LoadKeyring(filepath.Join(dir, "new.pem"), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ring.Active().ID != Thumbprint(newKey) || len(ring.Keys()) != 1 {
+		t.Errorf("active %s, want %s", ring.Active().ID, Thumbprint(newKey))
+	}
+	if Thumbprint(oldKey) == Thumbprint(newKey) {
+		t.Error("two keys have the same thumbprint")
+	}
+
+	tests := []struct {
+		name    string
+		entries []KeyEntry
+		err     string
+	}{
+		{
+			name:    "two active keys",
+			entries: []KeyEntry{{ID: "k1", File: "old.pem", Status: StatusActive}, {ID: "k2", File: "new.pem", Status: StatusActive}},
+			err:     "more than one active key",
+		},
+		{
+			name:    "no active key",
+			entries: []KeyEntry{{ID: "k1", File: "old.pem", Status: StatusDecrypt}},
+			err:     "no active key",
+		},
+		{
+			name:    "unknown status",
+			entries: []KeyEntry{{ID: "k1", File: "old.pem", Status: "disabled"}},
+			err:     "unknown status",
+		},
+		{
+			name:    "missing key",
+			entries: []KeyEntry{{ID: "k1", File: "gone.pem", Status: StatusDecrypt}, {ID: "k2", File: "new.pem", Status: StatusActive}},
+			err:     "Unable to read private key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadKeyring(testManifest(t, dir, tt.entries...), "passphrase")
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error %v, want %s", err, tt.err)
+			}
+		})
+	}
+
+	if _, err := LoadKeyring(filepath.Join(dir, "new.pem"), "wrong"); err == nil {
+		t.Error("key decrypted with the wrong passphrase")
+	}
+}
+
+func TestRollbackRotated(t *testing.T) {
+	oldKey, err := GenRSA(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := GenRSA(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := testKeyDir(t, map[string]crypto.Signer{"old.pem": oldKey, "new.pem": newKey})
+	defer os.RemoveAll(dir)
+
+	load := func(entries ...KeyEntry) *Credential {
+		cred := &Credential{KeyLocation: testManifest(t, dir, entries...), Passphrase: "passphrase"}
+		if err := cred.Load(); err != nil {
+			t.Fatal(err)
+		}
+		return cred
+	}
+	payload := map[string]interface{}{"customerx_id": "ea0212d3-abd6-406f-8c67-868e814a2436"}
+
+	before := load(KeyEntry{ID: "k1", File: "old.pem", Status: StatusActive})
+	token, err := before.Generate(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After the rotation the tokens of the previous key are still decrypted with it
+	rotated := load(
+		KeyEntry{ID: "k1", File: "old.pem", Status: StatusDecrypt},
+		KeyEntry{ID: "k2", File: "new.pem", Status: StatusActive},
+	)
+	res, err := rotated.Rollback(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["customerx_id"] != payload["customerx_id"] {
+		t.Errorf("payload %v, want %v", res, payload)
+	}
+	newToken, err := rotated.Generate(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := before.Rollback(newToken); err == nil || !strings.Contains(err.Error(), "k2") {
+		t.Errorf("error %v, want the unknown key k2", err)
+	}
+
+	// Once retired its tokens are rejected
+	retired := load(
+		KeyEntry{ID: "k1", File: "old.pem", Status: StatusRetired},
+		KeyEntry{ID: "k2", File: "new.pem", Status: StatusActive},
+	)
+	if _, err := retired.Rollback(token); err == nil || !strings.Contains(err.Error(), "retired key k1") {
+		t.Errorf("error %v, want the retired key k1", err)
+	}
+	if _, err := retired.Rollback(newToken); err != nil {
+		t.Error(err)
+	}
+}
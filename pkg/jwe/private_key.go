@@ -0,0 +1,109 @@
+package jwe
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+const (
+	// KeyTypeRSA ...
+	KeyTypeRSA = "rsa"
+	// KeyTypeEC P-256 key
+	KeyTypeEC = "ec"
+)
+
+func keyConfigSetup(privateKeyLocation, privateKeyPassword string) (crypto.Signer, error) {
+	if privateKeyLocation == "" {
+		return nil, errors.New("No private key location given")
+	}
+
+	priv, err := ioutil.ReadFile(privateKeyLocation)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read private key %s: %s", privateKeyLocation, err)
+	}
+
+	privPem, _ := pem.Decode(priv)
+	if privPem == nil {
+		return nil, fmt.Errorf("Private key %s is not PEM encoded", privateKeyLocation)
+	}
+	var privPemBytes []byte
+	if privPem.Type != "RSA PRIVATE KEY" && privPem.Type != "EC PRIVATE KEY" && privPem.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("Private key %s is of the wrong type %s", privateKeyLocation, privPem.Type)
+	}
+
+	if privateKeyPassword != "" {
+		privPemBytes, err = x509.DecryptPEMBlock(privPem, []byte(privateKeyPassword))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decrypt private key %s: %s", privateKeyLocation, err)
+		}
+	} else {
+		privPemBytes = privPem.Bytes
+	}
+
+	var parsedKey interface{}
+	if parsedKey, err = x509.ParsePKCS1PrivateKey(privPemBytes); err != nil {
+		if parsedKey, err = x509.ParseECPrivateKey(privPemBytes); err != nil {
+			if parsedKey, err = x509.ParsePKCS8PrivateKey(privPemBytes); err != nil { // note this returns type `interface{}`
+				return nil, fmt.Errorf("Unable to parse private key %s: %s", privateKeyLocation, err)
+			}
+		}
+	}
+
+	switch privateKey := parsedKey.(type) {
+	case *rsa.PrivateKey:
+		return privateKey, nil
+	case *ecdsa.PrivateKey:
+		if privateKey.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("Private key %s is not a P-256 key", privateKeyLocation)
+		}
+		return privateKey, nil
+	}
+
+	return nil, fmt.Errorf("Private key %s is not an RSA or EC key", privateKeyLocation)
+}
+
+// GenRSA returns a new RSA key of bits length
+func GenRSA(bits int) (*rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	return key, err
+}
+
+// GenEC returns a new P-256 key
+func GenEC() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// EncodeKey returns the PEM encoding of an RSA or EC private key, encrypted when a passphrase is given
+func EncodeKey(key crypto.Signer, passphrase string) ([]byte, error) {
+	var block *pem.Block
+	switch privateKey := key.(type) {
+	case *rsa.PrivateKey:
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}
+	case *ecdsa.PrivateKey:
+		b, err := x509.MarshalECPrivateKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}
+	default:
+		return nil, errors.New("Unsupported key type")
+	}
+
+	if passphrase != "" {
+		var err error
+		block, err = x509.EncryptPEMBlock(rand.Reader, block.Type, block.Bytes, []byte(passphrase), x509.PEMCipherAES256)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pem.EncodeToMemory(block), nil
+}
@@ -1,9 +1,32 @@
 package jwt
 
 import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"julo-backend/pkg/jwe"
+	"julo-backend/pkg/logruslogger"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/lestrrat/go-jwx/jwk"
+)
+
+const (
+	// AlgorithmHS256 sign with the shared secrets
+	AlgorithmHS256 = "HS256"
+	// AlgorithmRS256 sign with an RSA key of the signing keyring
+	AlgorithmRS256 = "RS256"
+	// AlgorithmES256 sign with a P-256 key of the signing keyring
+	AlgorithmES256 = "ES256"
+
+	// TokenTypeAccess ...
+	TokenTypeAccess = "access"
+	// TokenTypeRefresh ...
+	TokenTypeRefresh = "refresh"
+	// TokenTypeAdmin operator token of the admin api
+	TokenTypeAdmin = "admin"
 )
 
 // Credential ...
@@ -12,13 +35,89 @@ type Credential struct {
 	ExpSecret        int
 	RefreshSecret    string
 	RefreshExpSecret int
+	AdminExpSecret   int
+	Algorithm        string
+	KeyLocation      string
+	Passphrase       string
+	Keyring          *jwe.Keyring
+	// LegacyUntil RFC3339 sunset of the HS256 tokens issued before switching to an asymmetric
+	// algorithm, empty to reject them. It is ignored when the algorithm is HS256.
+	LegacyUntil string
+	legacyUntil time.Time
 }
 
-// jwtClaims ...
+// jwtClaims the token type keeps refresh and access tokens apart when they share a signing key
 type jwtClaims struct {
+	TokenType string `json:"token_type,omitempty"`
 	jwt.StandardClaims
 }
 
+// Load read the signing keyring once, it must be called before the credential is used
+func (cred *Credential) Load() (err error) {
+	if cred.Algorithm == "" {
+		cred.Algorithm = AlgorithmHS256
+	}
+
+	switch cred.Algorithm {
+	case AlgorithmHS256:
+		if cred.Secret == "" || cred.RefreshSecret == "" {
+			return errors.New("HS256 requires the token secrets")
+		}
+		return nil
+	case AlgorithmRS256, AlgorithmES256:
+		if cred.LegacyUntil != "" {
+			cred.legacyUntil, err = time.Parse(time.RFC3339, cred.LegacyUntil)
+			if err != nil {
+				return errors.New("Invalid HS256 sunset " + cred.LegacyUntil)
+			}
+			if cred.Secret == "" || cred.RefreshSecret == "" {
+				return errors.New("HS256 sunset requires the token secrets")
+			}
+		}
+
+		cred.Keyring, err = jwe.LoadKeyring(cred.KeyLocation, cred.Passphrase)
+		if err != nil {
+			return err
+		}
+		for _, key := range cred.Keyring.Keys() {
+			if !cred.fits(key) {
+				return errors.New(cred.Algorithm + " can not use key " + key.ID)
+			}
+		}
+		return nil
+	}
+
+	return errors.New("Unsupported JWT algorithm " + cred.Algorithm)
+}
+
+// fits check the key type matches the configured algorithm
+func (cred *Credential) fits(key *jwe.Key) bool {
+	switch key.PrivateKey.Public().(type) {
+	case *rsa.PublicKey:
+		return cred.Algorithm == AlgorithmRS256
+	case *ecdsa.PublicKey:
+		return cred.Algorithm == AlgorithmES256
+	}
+
+	return false
+}
+
+// sign the claims with the active key, or with the secret when the algorithm is HS256
+func (cred *Credential) sign(claims *jwtClaims, secret string) (string, error) {
+	if cred.Algorithm == "" || cred.Algorithm == AlgorithmHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	}
+	if cred.Keyring == nil {
+		return "", errors.New("JWT keyring is not loaded")
+	}
+
+	key := cred.Keyring.Active()
+	rawToken := jwt.NewWithClaims(jwt.GetSigningMethod(cred.Algorithm), claims)
+	rawToken.Header["kid"] = key.ID
+
+	return rawToken.SignedString(key.PrivateKey)
+}
+
 // GetToken ...
 func (cred *Credential) GetToken(id string) (string, string, error) {
 	expirationTime := time.Now().Add(time.Duration(cred.ExpSecret) * time.Hour).Unix()
@@ -27,13 +126,13 @@ func (cred *Credential) GetToken(id string) (string, string, error) {
 	unitTimeInRFC3339 := unixTimeUTC.UTC().Format(time.RFC3339)
 
 	claims := &jwtClaims{
+		TokenTypeAccess,
 		jwt.StandardClaims{
 			Id:        id,
 			ExpiresAt: expirationTime,
 		},
 	}
-	rawToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	token, err := rawToken.SignedString([]byte(cred.Secret))
+	token, err := cred.sign(claims, cred.Secret)
 
 	return token, unitTimeInRFC3339, err
 }
@@ -46,13 +145,101 @@ func (cred *Credential) GetRefreshToken(id string) (string, string, error) {
 	unitTimeInRFC3339 := unixTimeUTC.UTC().Format(time.RFC3339) // converts utc time to RFC3339 format
 
 	claims := &jwtClaims{
+		TokenTypeRefresh,
 		jwt.StandardClaims{
 			Id:        id,
 			ExpiresAt: expirationTime,
 		},
 	}
-	rawToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	token, err := rawToken.SignedString([]byte(cred.RefreshSecret))
+	token, err := cred.sign(claims, cred.RefreshSecret)
 
 	return token, unitTimeInRFC3339, err
 }
+
+// GetAdminToken short lived operator token, it has no refresh token
+func (cred *Credential) GetAdminToken(id string) (string, string, error) {
+	expirationTime := time.Now().Add(time.Duration(cred.AdminExpSecret) * time.Hour).Unix()
+
+	unixTimeUTC := time.Unix(expirationTime, 0)
+	unitTimeInRFC3339 := unixTimeUTC.UTC().Format(time.RFC3339)
+
+	claims := &jwtClaims{
+		TokenTypeAdmin,
+		jwt.StandardClaims{
+			Id:        id,
+			ExpiresAt: expirationTime,
+		},
+	}
+	token, err := cred.sign(claims, cred.Secret)
+
+	return token, unitTimeInRFC3339, err
+}
+
+// Parse verify the token of the given type and return its claims. HS256 tokens are still
+// accepted after switching to an asymmetric algorithm until the LegacyUntil sunset.
+func (cred *Credential) Parse(token, tokenType string) (res jwt.StandardClaims, err error) {
+	secret := cred.Secret
+	if tokenType == TokenTypeRefresh {
+		secret = cred.RefreshSecret
+	}
+
+	claims := &jwtClaims{}
+	asymmetric := false
+	_, err = jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method == jwt.SigningMethodHS256 {
+			if cred.Algorithm != AlgorithmHS256 {
+				if !time.Now().Before(cred.legacyUntil) {
+					return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+				}
+				logruslogger.Log(logruslogger.WarnLevel, tokenType, "jwt.Parse", "legacy_hs256", "")
+			}
+			return []byte(secret), nil
+		}
+		asymmetric = true
+		if token.Method.Alg() != cred.Algorithm || cred.Keyring == nil {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		key, ok := cred.Keyring.Find(kid)
+		if !ok {
+			return nil, errors.New("Unknown or retired key " + kid)
+		}
+
+		return key.PrivateKey.Public(), nil
+	})
+	if err != nil {
+		return res, err
+	}
+
+	// Both token types are signed with the same key when the algorithm is asymmetric
+	if claims.TokenType != "" && claims.TokenType != tokenType {
+		return res, errors.New("Unexpected token type " + claims.TokenType)
+	}
+	if claims.TokenType == "" && (asymmetric || tokenType == TokenTypeAdmin) {
+		return res, errors.New("Missing token type")
+	}
+
+	return claims.StandardClaims, err
+}
+
+// JWKS public keys other services verify the tokens with, empty when the algorithm is HS256
+func (cred *Credential) JWKS() (res jwk.Set, err error) {
+	res.Keys = []jwk.Key{}
+	if cred.Keyring == nil {
+		return res, err
+	}
+
+	for _, key := range cred.Keyring.Keys() {
+		publicKey, err := jwk.New(key.PrivateKey.Public())
+		if err != nil {
+			return res, err
+		}
+		publicKey.Set(jwk.KeyIDKey, key.ID)
+		publicKey.Set(jwk.AlgorithmKey, cred.Algorithm)
+		publicKey.Set(jwk.KeyUsageKey, string(jwk.ForSignature))
+		res.Keys = append(res.Keys, publicKey)
+	}
+
+	return res, err
+}
@@ -0,0 +1,85 @@
+package jwt
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"julo-backend/pkg/jwe"
+)
+
+func TestParseLegacyHS256(t *testing.T) {
+	key, err := jwe.GenRSA(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := jwe.EncodeKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := ioutil.TempFile("", "jwt*.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.Write(b)
+	file.Close()
+
+	legacy := &Credential{Secret: "secret", RefreshSecret: "refresh", ExpSecret: 1, RefreshExpSecret: 1}
+	if err := legacy.Load(); err != nil {
+		t.Fatal(err)
+	}
+	legacyToken, _, err := legacy.GetToken("payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		legacyUntil string
+		accepted    bool
+	}{
+		{name: "before the sunset", legacyUntil: time.Now().Add(time.Hour).Format(time.RFC3339), accepted: true},
+		{name: "after the sunset", legacyUntil: time.Now().Add(-time.Hour).Format(time.RFC3339)},
+		{name: "no sunset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cred := &Credential{
+				Secret: "secret", RefreshSecret: "refresh", ExpSecret: 1, RefreshExpSecret: 1,
+				Algorithm: AlgorithmRS256, KeyLocation: file.Name(), LegacyUntil: tt.legacyUntil,
+			}
+			if err := cred.Load(); err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := cred.Parse(legacyToken, TokenTypeAccess)
+			if !tt.accepted {
+				if err == nil || !strings.Contains(err.Error(), "HS256") {
+					t.Errorf("error %v, want HS256 rejected", err)
+				}
+			} else if err != nil || claims.Id != "payload" {
+				t.Errorf("claims %+v, %v", claims, err)
+			}
+
+			// The tokens issued now are signed with the key, a refresh token is not an access token
+			token, _, err := cred.GetRefreshToken("payload")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims, err := cred.Parse(token, TokenTypeRefresh); err != nil || claims.Id != "payload" {
+				t.Errorf("claims %+v, %v", claims, err)
+			}
+			if _, err := cred.Parse(token, TokenTypeAccess); err == nil {
+				t.Error("refresh token accepted as an access token")
+			}
+		})
+	}
+
+	cred := &Credential{Algorithm: AlgorithmRS256, KeyLocation: file.Name(), LegacyUntil: time.Now().Format(time.RFC3339)}
+	if err := cred.Load(); err == nil {
+		t.Error("loaded a sunset without the token secrets")
+	}
+}
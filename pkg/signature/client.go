@@ -0,0 +1,72 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Signer sign the requests of an api client with its secret
+//
+//	signer := signature.Signer{ClientID: clientID, Secret: secret}
+//	client := &http.Client{Transport: signer.Transport(nil)}
+type Signer struct {
+	ClientID string
+	Secret   string
+}
+
+// SignRequest set the signature headers, the body is read and restored
+func (s Signer) SignRequest(r *http.Request) error {
+	var body []byte
+	if r.Body != nil {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		r.Body.Close()
+		body = b
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(b)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	r.Header.Set(HeaderClientID, s.ClientID)
+	r.Header.Set(HeaderTimestamp, timestamp)
+	r.Header.Set(HeaderNonce, nonce)
+	r.Header.Set(HeaderSignature, Sign(s.Secret, r.Method, r.URL.RequestURI(), timestamp, nonce, body))
+
+	return nil
+}
+
+// Transport a round tripper signing every request, base defaults to http.DefaultTransport
+func (s Signer) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return roundTripper{signer: s, base: base}
+}
+
+type roundTripper struct {
+	signer Signer
+	base   http.RoundTripper
+}
+
+// RoundTrip sign a copy of the request, a round tripper must not modify the request it is given
+func (t roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	req := r.Clone(r.Context())
+	if err := t.signer.SignRequest(req); err != nil {
+		return nil, err
+	}
+
+	return t.base.RoundTrip(req)
+}
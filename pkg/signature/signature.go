@@ -0,0 +1,53 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// HeaderClientID client whose secret signed the request
+	HeaderClientID = "X-Client-Id"
+	// HeaderTimestamp unix time in seconds of the signature
+	HeaderTimestamp = "X-Timestamp"
+	// HeaderNonce unique value of the request, a nonce is only accepted once
+	HeaderNonce = "X-Nonce"
+	// HeaderSignature hex HMAC-SHA256 of the canonical request
+	HeaderSignature = "X-Signature"
+)
+
+// Canonical the signed string, one field per line:
+//
+//	METHOD
+//	/request/uri?with=query
+//	timestamp
+//	nonce
+//	hex SHA-256 of the body
+func Canonical(method, uri, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		uri,
+		timestamp,
+		nonce,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+}
+
+// Sign ...
+func Sign(secret, method, uri, timestamp, nonce string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(Canonical(method, uri, timestamp, nonce, body)))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify compare the signature in constant time
+func Verify(secret, signature, method, uri, timestamp, nonce string, body []byte) bool {
+	expected := Sign(secret, method, uri, timestamp, nonce, body)
+
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(signature)))
+}
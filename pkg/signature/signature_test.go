@@ -0,0 +1,110 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	body := []byte(`{"amount":10000}`)
+	bodyHash := sha256.Sum256(body)
+	want := "POST\n/api/v1/wallet/deposits?x=1\n1767225600\nn1\n" + hex.EncodeToString(bodyHash[:])
+	if res := Canonical("post", "/api/v1/wallet/deposits?x=1", "1767225600", "n1", body); res != want {
+		t.Errorf("canonical %q, want %q", res, want)
+	}
+
+	// An empty body is hashed like a missing one
+	if Canonical("GET", "/", "1", "n", nil) != Canonical("GET", "/", "1", "n", []byte{}) {
+		t.Error("empty and missing body differ")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	const (
+		secret    = "secret"
+		method    = "POST"
+		uri       = "/api/v1/wallet/deposits"
+		timestamp = "1767225600"
+		nonce     = "n1"
+	)
+	body := []byte(`{"amount":10000}`)
+	signature := Sign(secret, method, uri, timestamp, nonce, body)
+
+	if !Verify(secret, signature, method, uri, timestamp, nonce, body) {
+		t.Error("signature rejected")
+	}
+	if !Verify(secret, strings.ToUpper(signature), strings.ToLower(method), uri, timestamp, nonce, body) {
+		t.Error("signature rejected with another case")
+	}
+
+	tests := []struct {
+		name                                      string
+		secret, signature, method, uri, ts, nonce string
+		body                                      []byte
+	}{
+		{name: "secret", secret: "other"},
+		{name: "signature", signature: signature[:len(signature)-1]},
+		{name: "method", method: "PUT"},
+		{name: "uri", uri: uri + "?amount=1"},
+		{name: "timestamp", ts: "1767225601"},
+		{name: "nonce", nonce: "n2"},
+		{name: "body", body: []byte(`{"amount":10001}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every field is the signed one but the changed one
+			pick := func(changed, value string) string {
+				if changed != "" {
+					return changed
+				}
+				return value
+			}
+			changedBody := body
+			if tt.body != nil {
+				changedBody = tt.body
+			}
+			if Verify(pick(tt.secret, secret), pick(tt.signature, signature), pick(tt.method, method), pick(tt.uri, uri),
+				pick(tt.ts, timestamp), pick(tt.nonce, nonce), changedBody) {
+				t.Error("changed request accepted")
+			}
+		})
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	signer := Signer{ClientID: "client", Secret: "secret"}
+	body := []byte(`{"amount":10000}`)
+	r, err := http.NewRequest("POST", "http://localhost/api/v1/wallet/deposits?x=1", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = signer.SignRequest(r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Header.Get(HeaderClientID) != "client" || r.Header.Get(HeaderNonce) == "" {
+		t.Errorf("headers %v", r.Header)
+	}
+
+	// The body is still readable once signed
+	sent, _ := ioutil.ReadAll(r.Body)
+	if !bytes.Equal(sent, body) {
+		t.Errorf("body %s, want %s", sent, body)
+	}
+	if !Verify("secret", r.Header.Get(HeaderSignature), r.Method, r.URL.RequestURI(),
+		r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderNonce), sent) {
+		t.Error("signature rejected")
+	}
+
+	// Every request gets its own nonce
+	nonce := r.Header.Get(HeaderNonce)
+	signer.SignRequest(r)
+	if r.Header.Get(HeaderNonce) == nonce {
+		t.Error("nonce reused")
+	}
+}
@@ -2,9 +2,12 @@ package str
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 )
 
+var uuidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
 // Contains ...
 func Contains(slices []string, comparizon string) bool {
 	for _, a := range slices {
@@ -74,3 +77,8 @@ func ShowString(isShow bool, data string) string {
 
 	return ""
 }
+
+// IsUUID ...
+func IsUUID(data string) bool {
+	return uuidRegex.MatchString(data)
+}
@@ -1,7 +1,9 @@
 package bootstrap
 
 import (
+	"julo-backend/helper"
 	"julo-backend/pkg/logruslogger"
+	"julo-backend/pkg/str"
 	api "julo-backend/server/handler"
 	"julo-backend/server/middleware"
 
@@ -26,6 +28,17 @@ func (boot *Bootup) RegisterRoutes() {
 	mJwt := middleware.VerifyMiddlewareInit{
 		ContractUC: &boot.ContractUC,
 	}
+	mPermission := middleware.VerifyPermissionInit{
+		ContractUC: &boot.ContractUC,
+	}
+	mSignature := middleware.VerifySignatureInit{
+		ContractUC: &boot.ContractUC,
+		Required:   str.StringToBool(boot.EnvConfig["REQUEST_SIGNATURE_REQUIRED"]),
+	}
+
+	// Public keys other services verify the tokens with
+	jwksHandler := api.TokenHandler{Handler: handlerType}
+	boot.R.Get("/.well-known/jwks.json", jwksHandler.JwksHandler)
 
 	boot.R.Route("/api", func(r chi.Router) {
 		// Define a limit rate to 1000 requests per IP per request.
@@ -42,23 +55,72 @@ func (boot *Bootup) RegisterRoutes() {
 		r.Use(logruslogger.NewStructuredLogger(boot.EnvConfig["LOG_FILE_PATH"], boot.EnvConfig["LOG_DEFAULT"], boot.ContractUC.ReqID))
 		r.Use(chimiddleware.Recoverer)
 
+		// Operator API
+		r.Route("/admin/v1", func(r chi.Router) {
+			adminHandler := api.AdminHandler{Handler: handlerType}
+			r.Group(func(r chi.Router) {
+				r.Use(mJwt.VerifyBasicAuth)
+				r.Use(mSignature.VerifySignature)
+				r.Use(mJwt.VerifyClientScope(helper.ScopeAdmin))
+				r.Post("/token", adminHandler.TokenHandler)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(mJwt.VerifyAdminCredential)
+				r.Get("/wallets", adminHandler.GetWalletsHandler)
+				r.Get("/wallets/{id}", adminHandler.GetWalletHandler)
+				r.Patch("/wallets/{id}/status", adminHandler.UpdateStatusHandler)
+				r.Post("/wallets/{id}/close", adminHandler.CloseHandler)
+				r.Get("/operations/pending", adminHandler.GetPendingOperationsHandler)
+				r.Get("/audit", adminHandler.GetAuditEventsHandler)
+				r.Post("/sessions/revoke", adminHandler.RevokeSessionsHandler)
+			})
+		})
+
 		// API
 		r.Route("/v1", func(r chi.Router) {
 			walletHandler := api.WalletHandler{Handler: handlerType}
+			tokenHandler := api.TokenHandler{Handler: handlerType}
 			r.Group(func(r chi.Router) {
 				r.Use(mJwt.VerifyBasicAuth)
-				r.Post("/init", walletHandler.InitHandler)
+				r.Use(mSignature.VerifySignature)
+				r.With(mJwt.VerifyClientScope(helper.ScopeWalletInit)).Post("/init", walletHandler.InitHandler)
+				r.With(mJwt.VerifyClientScope(helper.ScopeSessionRevoke)).Post("/sessions/revoke", tokenHandler.RevokeHandler)
+			})
+
+			r.Route("/token", func(r chi.Router) {
+				r.Use(mJwt.VerifyRefreshTokenCredential)
+				r.Post("/refresh", tokenHandler.RefreshHandler)
+			})
+			sessionHandler := api.SessionHandler{Handler: handlerType}
+			r.Group(func(r chi.Router) {
+				r.Use(mJwt.VerifyTokenCredential)
+				r.Post("/logout", tokenHandler.LogoutHandler)
+				r.Get("/sessions", sessionHandler.GetSessionsHandler)
+				r.Delete("/sessions/{id}", sessionHandler.DeleteSessionHandler)
 			})
 
 			balanceHandler := api.BalanceHandler{Handler: handlerType}
+			transferHandler := api.TransferHandler{Handler: handlerType}
 			r.Route("/wallet", func(r chi.Router) {
 				r.Group(func(r chi.Router) {
 					r.Use(mJwt.VerifyTokenCredential)
-					r.Post("/", walletHandler.EnableHandler)
-					r.Get("/", walletHandler.GetWalletHandler)
-					r.Post("/deposits", balanceHandler.DepositHandler)
-					r.Post("/withdrawals", balanceHandler.WithdrawalHandler)
-					r.Patch("/", walletHandler.DisableHandler)
+					r.Use(mSignature.VerifySignature)
+					r.Group(func(r chi.Router) {
+						r.Use(mPermission.VerifyScope(helper.ScopeWalletRead))
+						r.Get("/", walletHandler.GetWalletHandler)
+						r.Get("/deposits", balanceHandler.GetDepositHandler)
+						r.Get("/deposits/{id}", balanceHandler.GetDepositHandler)
+						r.Get("/withdrawals", balanceHandler.GetWithdrawalHandler)
+						r.Get("/withdrawals/{id}", balanceHandler.GetWithdrawalHandler)
+						r.Get("/transactions", balanceHandler.TransactionHandler)
+					})
+					r.With(mPermission.VerifyScope(helper.ScopeWalletDeposit)).Post("/deposits", balanceHandler.DepositHandler)
+					r.With(mPermission.VerifyScope(helper.ScopeWalletWithdraw)).Post("/withdrawals", balanceHandler.WithdrawalHandler)
+					r.With(mPermission.VerifyScope(helper.ScopeWalletWithdraw)).Post("/transfers", transferHandler.TransferHandler)
+					r.With(mPermission.VerifyScope(helper.ScopeWalletManage)).Post("/", walletHandler.EnableHandler)
+					r.With(mPermission.VerifyScope(helper.ScopeWalletManage)).Patch("/", walletHandler.DisableHandler)
+					// Closing pays out the remaining balance
+					r.With(mPermission.VerifyScope(helper.ScopeWalletManage), mPermission.VerifyScope(helper.ScopeWalletWithdraw)).Post("/close", walletHandler.CloseHandler)
 				})
 			})
 		})
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"julo-backend/helper"
+	"julo-backend/model"
+	"julo-backend/pkg/str"
+	"julo-backend/server/request"
+	"julo-backend/usecase"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// AdminHandler ...
+type AdminHandler struct {
+	Handler
+}
+
+// adminUC the usecase acting on behalf of the operator of the admin token
+func (h *AdminHandler) adminUC(r *http.Request) usecase.AdminUC {
+	claim := requestIDFromContextInterface(r.Context(), helper.Token)
+	operator, _ := claim["operator"].(string)
+	clientID, _ := claim["client_id"].(string)
+
+	return usecase.AdminUC{
+		ContractUC: h.ContractUC,
+		Audit:      auditContext(r, adminActor(operator, clientID)),
+	}
+}
+
+// adminActor the audit actor of an operator of an api client
+func adminActor(operator, clientID string) string {
+	return helper.RoleAdmin + ":" + operator + "@" + clientID
+}
+
+// TokenHandler issue an admin token to an operator of the api client, the client authenticates the
+// operator and tells who it is so every action is recorded with the operator and the client
+func (h *AdminHandler) TokenHandler(w http.ResponseWriter, r *http.Request) {
+	req := request.AdminTokenRequest{}
+	if err := h.Handler.Bind(r, &req); err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+	if err := h.Handler.Validate.Struct(req); err != nil {
+		h.SendRequestValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+	client := requestIDFromContextInterface(r.Context(), helper.Client)
+	req.ClientID, _ = client["client_id"].(string)
+
+	adminUc := usecase.AdminUC{
+		ContractUC: h.ContractUC,
+		Audit:      auditContext(r, adminActor(req.Operator, req.ClientID)),
+	}
+	res, err := adminUc.GenerateToken(&req)
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	SendSuccess(w, res)
+}
+
+// GetWalletsHandler ...
+func (h *AdminHandler) GetWalletsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := request.AdminWalletRequest{
+		CustomerxID: query.Get("customer_xid"),
+		WalletID:    query.Get("wallet_id"),
+		Status:      query.Get("status"),
+		Cursor:      query.Get("cursor"),
+		Limit:       str.StringToInt(query.Get("limit")),
+	}
+	res, err := h.adminUC(r).FindWallets(&req)
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	SendSuccess(w, res)
+}
+
+// GetWalletHandler ...
+func (h *AdminHandler) GetWalletHandler(w http.ResponseWriter, r *http.Request) {
+	res, err := h.adminUC(r).FindWallet(chi.URLParam(r, "id"))
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	SendSuccess(w, res)
+}
+
+// UpdateStatusHandler ...
+func (h *AdminHandler) UpdateStatusHandler(w http.ResponseWriter, r *http.Request) {
+	req := request.AdminStatusRequest{}
+	if err := h.Handler.Bind(r, &req); err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+	if err := h.Handler.Validate.Struct(req); err != nil {
+		h.SendRequestValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	res, err := h.adminUC(r).UpdateStatus(chi.URLParam(r, "id"), &req)
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	SendSuccess(w, res)
+}
+
+// CloseHandler ...
+func (h *AdminHandler) CloseHandler(w http.ResponseWriter, r *http.Request) {
+	req := request.AdminCloseRequest{}
+	if err := h.Handler.Bind(r, &req); err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+	if err := h.Handler.Validate.Struct(req); err != nil {
+		h.SendRequestValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	res, err := h.adminUC(r).Close(chi.URLParam(r, "id"), &req)
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	SendSuccess(w, res)
+}
+
+// GetPendingOperationsHandler ...
+func (h *AdminHandler) GetPendingOperationsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	res, err := h.adminUC(r).FindPendingOperations(query.Get("cursor"), str.StringToInt(query.Get("limit")))
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	SendSuccess(w, res)
+}
+
+// GetAuditEventsHandler ...
+func (h *AdminHandler) GetAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	parameter := model.AuditParameter{
+		WalletID: query.Get("wallet_id"),
+		Actor:    query.Get("actor"),
+		Action:   query.Get("action"),
+		Limit:    str.StringToInt(query.Get("limit")),
+	}
+	res, err := h.adminUC(r).FindAuditEvents(parameter, query.Get("cursor"))
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	SendSuccess(w, res)
+}
+
+// RevokeSessionsHandler ...
+func (h *AdminHandler) RevokeSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	req := request.RevokeRequest{}
+	if err := h.Handler.Bind(r, &req); err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+	if err := h.Handler.Validate.Struct(req); err != nil {
+		h.SendRequestValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	err := h.adminUC(r).RevokeSessions(req.CustomerxID)
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	SendSuccess(w, map[string]interface{}{})
+}
@@ -8,9 +8,11 @@ import (
 
 	"julo-backend/pkg/str"
 	"julo-backend/usecase"
+	"julo-backend/usecase/viewmodel"
 
 	"database/sql"
 
+	chimiddleware "github.com/go-chi/chi/middleware"
 	ut "github.com/go-playground/universal-translator"
 	validator "gopkg.in/go-playground/validator.v9"
 )
@@ -74,6 +76,15 @@ func RespondWithJSON(w http.ResponseWriter, httpCode int, message string, payloa
 	w.Write(response)
 }
 
+// auditContext who is acting on the request, recorded with every change it makes
+func auditContext(r *http.Request, actor string) viewmodel.AuditContextVM {
+	return viewmodel.AuditContextVM{
+		Actor:     actor,
+		RequestID: chimiddleware.GetReqID(r.Context()),
+		IP:        r.RemoteAddr,
+	}
+}
+
 // requestIDFromContextInterface ...
 func requestIDFromContextInterface(ctx context.Context, key string) map[string]interface{} {
 	return ctx.Value(key).(map[string]interface{})
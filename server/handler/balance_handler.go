@@ -2,10 +2,12 @@ package handler
 
 import (
 	"julo-backend/helper"
+	"julo-backend/pkg/str"
 	"julo-backend/server/request"
 	"julo-backend/usecase"
 	"net/http"
 
+	"github.com/go-chi/chi"
 	validator "gopkg.in/go-playground/validator.v9"
 )
 
@@ -28,8 +30,9 @@ func (h *BalanceHandler) DepositHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if claim["status"].(string) != helper.StatusEnabled {
-		SendBadRequest(w, "Disabled")
+	// A frozen wallet may still accept deposits, the usecase checks the freeze
+	if status := claim["status"].(string); status != helper.StatusEnabled && status != helper.StatusFrozen {
+		SendBadRequest(w, helper.Disabled)
 		return
 	}
 
@@ -43,7 +46,7 @@ func (h *BalanceHandler) DepositHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	req.CustomerxID = customerxID
-	balanceUc := usecase.BalanceUC{ContractUC: h.ContractUC}
+	balanceUc := usecase.BalanceUC{ContractUC: h.ContractUC, Audit: auditContext(r, h.ContractUC.CustomerActor(customerxID))}
 	res, err := balanceUc.Deposit(&req)
 	if err != nil {
 		SendBadRequest(w, err.Error())
@@ -66,6 +69,10 @@ func (h *BalanceHandler) WithdrawalHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if claim["status"].(string) == helper.StatusFrozen {
+		SendBadRequest(w, helper.Frozen)
+		return
+	}
 	if claim["status"].(string) != helper.StatusEnabled {
 		SendBadRequest(w, helper.Disabled)
 		return
@@ -81,7 +88,7 @@ func (h *BalanceHandler) WithdrawalHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	req.CustomerxID = customerxID
-	balanceUc := usecase.BalanceUC{ContractUC: h.ContractUC}
+	balanceUc := usecase.BalanceUC{ContractUC: h.ContractUC, Audit: auditContext(r, h.ContractUC.CustomerActor(customerxID))}
 	res, err := balanceUc.Withdrawal(&req)
 	if err != nil {
 		SendBadRequest(w, err.Error())
@@ -90,3 +97,92 @@ func (h *BalanceHandler) WithdrawalHandler(w http.ResponseWriter, r *http.Reques
 
 	SendSuccess(w, res)
 }
+
+// TransactionHandler ...
+func (h *BalanceHandler) TransactionHandler(w http.ResponseWriter, r *http.Request) {
+	claim := requestIDFromContextInterface(r.Context(), helper.Token)
+	if claim == nil {
+		SendBadRequest(w, "Invalid claim")
+		return
+	}
+
+	customerxID := claim["customerx_id"].(string)
+	if customerxID == "" {
+		SendBadRequest(w, "Invalid customerx id")
+		return
+	}
+
+	// The history of a closed wallet stays readable
+	if status := claim["status"].(string); !str.Contains([]string{helper.StatusEnabled, helper.StatusFrozen, helper.StatusClosed}, status) {
+		SendBadRequest(w, helper.Disabled)
+		return
+	}
+
+	query := r.URL.Query()
+	req := request.TransactionRequest{
+		CustomerxID: customerxID,
+		Limit:       str.StringToInt(query.Get("limit")),
+		Cursor:      query.Get("cursor"),
+		Type:        query.Get("type"),
+		Status:      query.Get("status"),
+		StartDate:   query.Get("start_date"),
+		EndDate:     query.Get("end_date"),
+		Sort:        query.Get("sort"),
+	}
+	balanceUc := usecase.BalanceUC{ContractUC: h.ContractUC}
+	res, err := balanceUc.FindTransactions(&req)
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	SendSuccess(w, res)
+}
+
+// GetDepositHandler ...
+func (h *BalanceHandler) GetDepositHandler(w http.ResponseWriter, r *http.Request) {
+	claim := requestIDFromContextInterface(r.Context(), helper.Token)
+	if claim == nil {
+		SendBadRequest(w, "Invalid claim")
+		return
+	}
+
+	customerxID := claim["customerx_id"].(string)
+	if customerxID == "" {
+		SendBadRequest(w, "Invalid customerx id")
+		return
+	}
+
+	balanceUc := usecase.BalanceUC{ContractUC: h.ContractUC}
+	res, err := balanceUc.FindDeposit(customerxID, chi.URLParam(r, "id"), r.URL.Query().Get("reference_id"))
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	SendSuccess(w, res)
+}
+
+// GetWithdrawalHandler ...
+func (h *BalanceHandler) GetWithdrawalHandler(w http.ResponseWriter, r *http.Request) {
+	claim := requestIDFromContextInterface(r.Context(), helper.Token)
+	if claim == nil {
+		SendBadRequest(w, "Invalid claim")
+		return
+	}
+
+	customerxID := claim["customerx_id"].(string)
+	if customerxID == "" {
+		SendBadRequest(w, "Invalid customerx id")
+		return
+	}
+
+	balanceUc := usecase.BalanceUC{ContractUC: h.ContractUC}
+	res, err := balanceUc.FindWithdrawal(customerxID, chi.URLParam(r, "id"), r.URL.Query().Get("reference_id"))
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	SendSuccess(w, res)
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"julo-backend/helper"
+	"julo-backend/usecase"
+	"julo-backend/usecase/viewmodel"
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+// SessionHandler ...
+type SessionHandler struct {
+	Handler
+}
+
+// GetSessionsHandler ...
+func (h *SessionHandler) GetSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	claim := requestIDFromContextInterface(r.Context(), helper.Token)
+	if claim == nil {
+		SendBadRequest(w, "Invalid claim")
+		return
+	}
+
+	customerxID := claim["customerx_id"].(string)
+	if customerxID == "" {
+		SendBadRequest(w, "Invalid customerx id")
+		return
+	}
+
+	sessionUc := usecase.SessionUC{ContractUC: h.ContractUC}
+	sessions, err := sessionUc.FindAll(customerxID)
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].SessionID == claim["session_id"]
+	}
+
+	SendSuccess(w, viewmodel.SessionListVM{Sessions: sessions})
+}
+
+// DeleteSessionHandler ...
+func (h *SessionHandler) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	claim := requestIDFromContextInterface(r.Context(), helper.Token)
+	if claim == nil {
+		SendBadRequest(w, "Invalid claim")
+		return
+	}
+
+	customerxID := claim["customerx_id"].(string)
+	if customerxID == "" {
+		SendBadRequest(w, "Invalid customerx id")
+		return
+	}
+
+	sessionUc := usecase.SessionUC{ContractUC: h.ContractUC}
+	err := sessionUc.Delete(customerxID, chi.URLParam(r, "id"))
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	SendSuccess(w, map[string]interface{}{})
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/json"
+	"julo-backend/helper"
+	"julo-backend/server/request"
+	"julo-backend/usecase"
+	"net/http"
+
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// TokenHandler ...
+type TokenHandler struct {
+	Handler
+}
+
+// RefreshHandler ...
+func (h *TokenHandler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	claim := requestIDFromContextInterface(r.Context(), helper.Token)
+	if claim == nil {
+		SendBadRequest(w, "Invalid claim")
+		return
+	}
+
+	jwtUc := usecase.JwtUC{ContractUC: h.ContractUC}
+	res, err := jwtUc.Refresh(claim)
+	if err != nil {
+		RespondWithJSON(w, 401, err.Error(), []map[string]interface{}{})
+		return
+	}
+
+	SendSuccess(w, res)
+}
+
+// LogoutHandler ...
+func (h *TokenHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	claim := requestIDFromContextInterface(r.Context(), helper.Token)
+	if claim == nil {
+		SendBadRequest(w, "Invalid claim")
+		return
+	}
+
+	jwtUc := usecase.JwtUC{ContractUC: h.ContractUC}
+	err := jwtUc.Logout(claim)
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	SendSuccess(w, map[string]interface{}{})
+}
+
+// RevokeHandler ...
+func (h *TokenHandler) RevokeHandler(w http.ResponseWriter, r *http.Request) {
+	req := request.RevokeRequest{}
+	if err := h.Handler.Bind(r, &req); err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+	if err := h.Handler.Validate.Struct(req); err != nil {
+		h.SendRequestValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+
+	jwtUc := usecase.JwtUC{ContractUC: h.ContractUC}
+	err := jwtUc.RevokeAll(req.CustomerxID)
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	SendSuccess(w, map[string]interface{}{})
+}
+
+// JwksHandler publish the token signing public keys, the body is a plain JWK set so any JOSE library can read it
+func (h *TokenHandler) JwksHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.ContractUC.Jwt.JWKS()
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+	response, err := json.Marshal(keys)
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
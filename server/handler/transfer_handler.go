@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"julo-backend/helper"
+	"julo-backend/server/request"
+	"julo-backend/usecase"
+	"net/http"
+
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// TransferHandler ...
+type TransferHandler struct {
+	Handler
+}
+
+// TransferHandler ...
+func (h *TransferHandler) TransferHandler(w http.ResponseWriter, r *http.Request) {
+	claim := requestIDFromContextInterface(r.Context(), helper.Token)
+	if claim == nil {
+		SendBadRequest(w, "Invalid claim")
+		return
+	}
+
+	customerxID := claim["customerx_id"].(string)
+	if customerxID == "" {
+		SendBadRequest(w, "Invalid customerx id")
+		return
+	}
+
+	if claim["status"].(string) == helper.StatusFrozen {
+		SendBadRequest(w, helper.Frozen)
+		return
+	}
+	if claim["status"].(string) != helper.StatusEnabled {
+		SendBadRequest(w, helper.Disabled)
+		return
+	}
+
+	req := request.TransferRequest{}
+	if err := h.Handler.Bind(r, &req); err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+	if err := h.Handler.Validate.Struct(req); err != nil {
+		h.SendRequestValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+	req.CustomerxID = customerxID
+	transferUc := usecase.TransferUC{ContractUC: h.ContractUC, Audit: auditContext(r, h.ContractUC.CustomerActor(customerxID))}
+	res, err := transferUc.Transfer(&req)
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	SendSuccess(w, res)
+}
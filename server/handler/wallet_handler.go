@@ -25,7 +25,12 @@ func (h *WalletHandler) InitHandler(w http.ResponseWriter, r *http.Request) {
 		h.SendRequestValidationError(w, err.(validator.ValidationErrors))
 		return
 	}
-	walletUc := usecase.WalletUC{ContractUC: h.ContractUC}
+	req.UserAgent = r.UserAgent()
+	req.IP = r.RemoteAddr
+	client := requestIDFromContextInterface(r.Context(), helper.Client)
+	req.ClientID, _ = client["client_id"].(string)
+	req.ClientScopes, _ = client["scopes"].([]string)
+	walletUc := usecase.WalletUC{ContractUC: h.ContractUC, Audit: auditContext(r, "client:"+req.ClientID)}
 	res, err := walletUc.Init(&req)
 	if err != nil {
 		SendBadRequest(w, err.Error())
@@ -49,7 +54,7 @@ func (h *WalletHandler) EnableHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	walletUc := usecase.WalletUC{ContractUC: h.ContractUC}
+	walletUc := usecase.WalletUC{ContractUC: h.ContractUC, Audit: auditContext(r, h.ContractUC.CustomerActor(customerxID))}
 	res, err := walletUc.Enable(customerxID)
 	if err != nil {
 		SendBadRequest(w, err.Error())
@@ -97,7 +102,7 @@ func (h *WalletHandler) DisableHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	walletUc := usecase.WalletUC{ContractUC: h.ContractUC}
+	walletUc := usecase.WalletUC{ContractUC: h.ContractUC, Audit: auditContext(r, h.ContractUC.CustomerActor(customerxID))}
 	res, err := walletUc.Disable(customerxID)
 	if err != nil {
 		SendBadRequest(w, err.Error())
@@ -106,3 +111,37 @@ func (h *WalletHandler) DisableHandler(w http.ResponseWriter, r *http.Request) {
 
 	SendSuccess(w, res)
 }
+
+// CloseHandler ...
+func (h *WalletHandler) CloseHandler(w http.ResponseWriter, r *http.Request) {
+	claim := requestIDFromContextInterface(r.Context(), helper.Token)
+	if claim == nil {
+		SendBadRequest(w, "Invalid claim")
+		return
+	}
+
+	customerxID := claim["customerx_id"].(string)
+	if customerxID == "" {
+		SendBadRequest(w, "Invalid customerx id")
+		return
+	}
+
+	req := request.WalletCloseRequest{}
+	if err := h.Handler.Bind(r, &req); err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+	if err := h.Handler.Validate.Struct(req); err != nil {
+		h.SendRequestValidationError(w, err.(validator.ValidationErrors))
+		return
+	}
+	req.CustomerxID = customerxID
+	walletUc := usecase.WalletUC{ContractUC: h.ContractUC, Audit: auditContext(r, h.ContractUC.CustomerActor(customerxID))}
+	res, err := walletUc.Close(&req)
+	if err != nil {
+		SendBadRequest(w, err.Error())
+		return
+	}
+
+	SendSuccess(w, res)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"julo-backend/pkg/aes"
+	"julo-backend/pkg/amqp"
 	"julo-backend/pkg/env"
 	"julo-backend/pkg/interfacepkg"
 	"julo-backend/pkg/jwe"
@@ -90,12 +91,25 @@ func main() {
 		ExpSecret:        str.StringToInt(envConfig["TOKEN_EXP_SECRET"]),
 		RefreshSecret:    envConfig["TOKEN_REFRESH_SECRET"],
 		RefreshExpSecret: str.StringToInt(envConfig["TOKEN_EXP_REFRESH_SECRET"]),
+		AdminExpSecret:   str.StringToInt(envConfig["TOKEN_EXP_ADMIN_SECRET"]),
+		Algorithm:        envConfig["TOKEN_ALGORITHM"],
+		KeyLocation:      envConfig["TOKEN_SIGNING_KEY_LOCATION"],
+		Passphrase:       envConfig["TOKEN_SIGNING_KEY_PASSPHRASE"],
+		LegacyUntil:      envConfig["TOKEN_HS256_UNTIL"],
+	}
+	if err = jwtCredential.Load(); err != nil {
+		panic(err)
 	}
 
 	// JWE credential
 	jweCredential := jwe.Credential{
 		KeyLocation: envConfig["APP_PRIVATE_KEY_LOCATION"],
 		Passphrase:  envConfig["APP_PRIVATE_KEY_PASSPHRASE"],
+		Algorithm:   envConfig["APP_JWE_ALGORITHM"],
+		LegacyUntil: envConfig["APP_JWE_RSA1_5_UNTIL"],
+	}
+	if err = jweCredential.Load(); err != nil {
+		panic(err)
 	}
 
 	// AES credential
@@ -117,6 +131,13 @@ func main() {
 		Aes:       aesCredential,
 	}
 
+	// Publish balance queue messages written to the outbox
+	outboxUc := usecase.OutboxUC{
+		ContractUC: &contractUC,
+		Queue:      &amqp.ConfirmQueue{URL: envConfig["AMQP_URL"], Timeout: usecase.OutboxConfirmTimeout},
+	}
+	go outboxUc.Relay(usecase.OutboxRelayInterval)
+
 	r := chi.NewRouter()
 	// Cors setup
 	r.Use(cors.New(cors.Options{
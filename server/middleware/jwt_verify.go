@@ -3,23 +3,18 @@ package middleware
 import (
 	"context"
 	"errors"
-	"fmt"
 	"strings"
 
 	"net/http"
 	"time"
 
-	jwt "github.com/dgrijalva/jwt-go"
-
 	"julo-backend/helper"
+	"julo-backend/pkg/jwt"
+	"julo-backend/pkg/str"
 	apiHandler "julo-backend/server/handler"
 	"julo-backend/usecase"
 )
 
-type jwtClaims struct {
-	jwt.StandardClaims
-}
-
 // VerifyMiddlewareInit ...
 type VerifyMiddlewareInit struct {
 	*usecase.ContractUC
@@ -28,7 +23,6 @@ type VerifyMiddlewareInit struct {
 // VerifyPermissionInit ...
 type VerifyPermissionInit struct {
 	*usecase.ContractUC
-	Menu string
 }
 
 func userContextInterface(ctx context.Context, req *http.Request, subject string, body map[string]interface{}) context.Context {
@@ -36,22 +30,13 @@ func userContextInterface(ctx context.Context, req *http.Request, subject string
 }
 
 func (m VerifyMiddlewareInit) verifyJWT(r *http.Request, singleLogin bool) (res map[string]interface{}, err error) {
-	claims := &jwtClaims{}
-
 	tokenAuthHeader := r.Header.Get("Authorization")
 	if !strings.Contains(tokenAuthHeader, "Bearer") {
 		return res, errors.New("Invalid token")
 	}
 	tokenAuth := strings.Replace(tokenAuthHeader, "Bearer ", "", -1)
 
-	_, err = jwt.ParseWithClaims(tokenAuth, claims, func(token *jwt.Token) (interface{}, error) {
-		if jwt.SigningMethodHS256 != token.Method {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-
-		secret := m.ContractUC.EnvConfig["TOKEN_SECRET"]
-		return []byte(secret), nil
-	})
+	claims, err := m.ContractUC.Jwt.Parse(tokenAuth, jwt.TokenTypeAccess)
 	if err != nil {
 		return res, errors.New("Invalid Token!")
 	}
@@ -66,37 +51,37 @@ func (m VerifyMiddlewareInit) verifyJWT(r *http.Request, singleLogin bool) (res
 		return res, errors.New("Error when load the payload!")
 	}
 
+	jwtUc := usecase.JwtUC{ContractUC: m.ContractUC}
+	tokenID, _ := res["token_id"].(string)
+	if jwtUc.IsDenied(tokenID) {
+		return res, errors.New("Revoked Token!")
+	}
+
 	if singleLogin {
-		var deviceID string
-		err = m.ContractUC.GetFromRedis("userDeviceID"+res["customerx_id"].(string), &deviceID)
+		customerxID, _ := res["customerx_id"].(string)
+		sessionID, _ := res["session_id"].(string)
+		sessionUc := usecase.SessionUC{ContractUC: m.ContractUC}
+		session, err := sessionUc.Find(customerxID, sessionID)
 		if err != nil {
 			return res, errors.New("Invalid Device!")
 		}
-		if deviceID != res["device_id"].(string) {
+		if session.DeviceID != res["device_id"] {
 			return res, errors.New("Expired Device Token!")
 		}
+		sessionUc.Touch(customerxID, session)
 	}
 
 	return res, nil
 }
 
 func (m VerifyMiddlewareInit) verifyRefreshJWT(r *http.Request, role string) (res map[string]interface{}, err error) {
-	claims := &jwtClaims{}
-
 	tokenAuthHeader := r.Header.Get("Authorization")
 	if !strings.Contains(tokenAuthHeader, "Bearer") {
 		return res, errors.New("Invalid token")
 	}
 	tokenAuth := strings.Replace(tokenAuthHeader, "Bearer ", "", -1)
 
-	_, err = jwt.ParseWithClaims(tokenAuth, claims, func(token *jwt.Token) (interface{}, error) {
-		if jwt.SigningMethodHS256 != token.Method {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-
-		secret := m.ContractUC.EnvConfig["TOKEN_REFRESH_SECRET"]
-		return []byte(secret), nil
-	})
+	claims, err := m.ContractUC.Jwt.Parse(tokenAuth, jwt.TokenTypeRefresh)
 	if err != nil {
 		return res, errors.New("Invalid Token!")
 	}
@@ -112,6 +97,9 @@ func (m VerifyMiddlewareInit) verifyRefreshJWT(r *http.Request, role string) (re
 	}
 
 	// Check if the token provided has a valid role
+	if role == "" {
+		return res, nil
+	}
 	if res["role"] == nil {
 		return res, errors.New("Invalid " + role + " token!")
 	}
@@ -122,10 +110,49 @@ func (m VerifyMiddlewareInit) verifyRefreshJWT(r *http.Request, role string) (re
 	return res, nil
 }
 
+func (m VerifyMiddlewareInit) verifyAdminJWT(r *http.Request) (res map[string]interface{}, err error) {
+	tokenAuthHeader := r.Header.Get("Authorization")
+	if !strings.Contains(tokenAuthHeader, "Bearer") {
+		return res, errors.New("Invalid token")
+	}
+	tokenAuth := strings.Replace(tokenAuthHeader, "Bearer ", "", -1)
+
+	claims, err := m.ContractUC.Jwt.Parse(tokenAuth, jwt.TokenTypeAdmin)
+	if err != nil {
+		return res, errors.New("Invalid Token!")
+	}
+
+	if claims.ExpiresAt < time.Now().Unix() {
+		return res, errors.New("Expired Token!")
+	}
+
+	// Decrypt payload
+	res, err = m.ContractUC.Jwe.Rollback(claims.Id)
+	if err != nil {
+		return res, errors.New("Error when load the payload!")
+	}
+
+	if res["role"] != helper.RoleAdmin {
+		return res, errors.New("Not an " + helper.RoleAdmin + " token!")
+	}
+	operator, _ := res["operator"].(string)
+	if operator == "" {
+		return res, errors.New("Invalid " + helper.RoleAdmin + " token!")
+	}
+
+	jwtUc := usecase.JwtUC{ContractUC: m.ContractUC}
+	tokenID, _ := res["token_id"].(string)
+	if jwtUc.IsDenied(tokenID) {
+		return res, errors.New("Revoked Token!")
+	}
+
+	return res, nil
+}
+
 // VerifyTokenCredential ...
 func (m VerifyMiddlewareInit) VerifyTokenCredential(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		jweRes, err := m.verifyJWT(r, false)
+		jweRes, err := m.verifyJWT(r, true)
 		if err != nil {
 			apiHandler.RespondWithJSON(w, 401, err.Error(), []map[string]interface{}{})
 			return
@@ -146,15 +173,73 @@ func (m VerifyMiddlewareInit) VerifyTokenCredential(next http.Handler) http.Hand
 	})
 }
 
-// VerifyBasicAuth ...
+// VerifyRefreshTokenCredential ...
+func (m VerifyMiddlewareInit) VerifyRefreshTokenCredential(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jweRes, err := m.verifyRefreshJWT(r, "")
+		if err != nil {
+			apiHandler.RespondWithJSON(w, 401, err.Error(), []map[string]interface{}{})
+			return
+		}
+
+		ctx := userContextInterface(r.Context(), r, helper.Token, jweRes)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// VerifyAdminCredential ...
+func (m VerifyMiddlewareInit) VerifyAdminCredential(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jweRes, err := m.verifyAdminJWT(r)
+		if err != nil {
+			apiHandler.RespondWithJSON(w, 401, err.Error(), []map[string]interface{}{})
+			return
+		}
+
+		ctx := userContextInterface(r.Context(), r, helper.Token, jweRes)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// VerifyBasicAuth authenticate the api client with HTTP Basic client_id:client_secret
 func (m VerifyMiddlewareInit) VerifyBasicAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		value := r.Header.Get("Authorization")
-		if value != m.ContractUC.EnvConfig["AUTHORIZATION"] {
-			http.Error(w, "Invalid Authorization", http.StatusBadRequest)
+		clientID, secret, ok := r.BasicAuth()
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="api"`)
+			apiHandler.RespondWithJSON(w, 401, helper.InvalidClient, []map[string]interface{}{})
+			return
+		}
+
+		clientUc := usecase.ApiClientUC{ContractUC: m.ContractUC}
+		client, err := clientUc.Authenticate(clientID, secret)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="api"`)
+			apiHandler.RespondWithJSON(w, 401, helper.InvalidClient, []map[string]interface{}{})
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		ctx := userContextInterface(r.Context(), r, helper.Client, map[string]interface{}{
+			"client_id": client.ClientID,
+			"name":      client.Name,
+			"scopes":    client.Scopes,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// VerifyClientScope reject the api clients which were not granted the scope, must be used after VerifyBasicAuth
+func (m VerifyMiddlewareInit) VerifyClientScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client, _ := r.Context().Value(helper.Client).(map[string]interface{})
+			scopes, _ := client["scopes"].([]string)
+			if !str.Contains(scopes, scope) {
+				apiHandler.RespondWithJSON(w, 403, helper.InsufficientScope, []map[string]interface{}{})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+
+	"julo-backend/helper"
+	"julo-backend/pkg/str"
+	apiHandler "julo-backend/server/handler"
+)
+
+// VerifyScope reject the tokens which do not carry the scope, must be used after VerifyTokenCredential
+func (m VerifyPermissionInit) VerifyScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claim, _ := r.Context().Value(helper.Token).(map[string]interface{})
+			if !str.Contains(claimScopes(claim), scope) {
+				apiHandler.RespondWithJSON(w, 403, helper.InsufficientScope, []map[string]interface{}{})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// claimScopes the scopes of the token payload, a token without scopes has none and its
+// customer gets a new token from /init
+func claimScopes(claim map[string]interface{}) (res []string) {
+	values, _ := claim["scopes"].([]interface{})
+	for _, v := range values {
+		if scope, ok := v.(string); ok {
+			res = append(res, scope)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"julo-backend/helper"
+	"reflect"
+	"testing"
+)
+
+func TestClaimScopes(t *testing.T) {
+	tests := []struct {
+		name  string
+		claim map[string]interface{}
+		want  []string
+	}{
+		{
+			name:  "scopes",
+			claim: map[string]interface{}{"scopes": []interface{}{helper.ScopeWalletRead, helper.ScopeWalletDeposit}},
+			want:  []string{helper.ScopeWalletRead, helper.ScopeWalletDeposit},
+		},
+		{
+			name:  "no scopes",
+			claim: map[string]interface{}{"customerx_id": "ea0212d3-abd6-406f-8c67-868e814a2436"},
+		},
+		{
+			name:  "empty scopes",
+			claim: map[string]interface{}{"scopes": []interface{}{}},
+		},
+		{
+			name:  "not a list",
+			claim: map[string]interface{}{"scopes": helper.ScopeWalletManage},
+		},
+		{
+			name:  "not a string",
+			claim: map[string]interface{}{"scopes": []interface{}{helper.ScopeWalletRead, 1, nil}},
+			want:  []string{helper.ScopeWalletRead},
+		},
+		{
+			name: "no claim",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := claimScopes(tt.claim); !reflect.DeepEqual(res, tt.want) {
+				t.Errorf("scopes %v, want %v", res, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"julo-backend/helper"
+	"julo-backend/pkg/signature"
+	apiHandler "julo-backend/server/handler"
+	"julo-backend/usecase"
+)
+
+// VerifySignatureInit ...
+type VerifySignatureInit struct {
+	*usecase.ContractUC
+	// Required reject the unsigned requests, otherwise only the signed requests are verified
+	Required bool
+}
+
+// VerifySignature verify the HMAC-SHA256 signature of the method, uri, timestamp, nonce and body
+// of the request with the secret of the api client, see pkg/signature to sign the requests. It must
+// be used after VerifyBasicAuth or VerifyTokenCredential, the signing client must be the client the
+// request is authenticated as.
+func (m VerifySignatureInit) VerifySignature(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sig := r.Header.Get(signature.HeaderSignature)
+		if sig == "" {
+			if m.Required {
+				apiHandler.RespondWithJSON(w, 401, helper.InvalidSignature, []map[string]interface{}{})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		clientID := r.Header.Get(signature.HeaderClientID)
+		timestamp := r.Header.Get(signature.HeaderTimestamp)
+		nonce := r.Header.Get(signature.HeaderNonce)
+		if clientID == "" || timestamp == "" || nonce == "" {
+			apiHandler.RespondWithJSON(w, 401, helper.InvalidSignature, []map[string]interface{}{})
+			return
+		}
+		if clientID != authenticatedClientID(r) {
+			apiHandler.RespondWithJSON(w, 401, helper.InvalidClient, []map[string]interface{}{})
+			return
+		}
+
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			apiHandler.RespondWithJSON(w, 401, helper.InvalidSignature, []map[string]interface{}{})
+			return
+		}
+		skew := time.Since(time.Unix(unix, 0))
+		if skew > usecase.SignatureMaxSkew || skew < -usecase.SignatureMaxSkew {
+			apiHandler.RespondWithJSON(w, 401, helper.ExpiredSignature, []map[string]interface{}{})
+			return
+		}
+
+		// The body is read to be hashed and restored for the handler
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, usecase.SignatureMaxBody))
+		if err != nil {
+			apiHandler.SendBadRequest(w, err.Error())
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		clientUc := usecase.ApiClientUC{ContractUC: m.ContractUC}
+		secret, err := clientUc.SigningSecret(clientID)
+		if err != nil {
+			apiHandler.RespondWithJSON(w, 401, helper.InvalidClient, []map[string]interface{}{})
+			return
+		}
+		if !signature.Verify(secret, sig, r.Method, r.URL.RequestURI(), timestamp, nonce, body) {
+			apiHandler.RespondWithJSON(w, 401, helper.InvalidSignature, []map[string]interface{}{})
+			return
+		}
+
+		// A nonce outlives the window of its timestamp so a captured request can not be replayed
+		ok, err := clientUc.UseNonce(clientID, nonce, 2*usecase.SignatureMaxSkew)
+		if err != nil {
+			apiHandler.RespondWithJSON(w, 500, helper.InternalServer, []map[string]interface{}{})
+			return
+		}
+		if !ok {
+			apiHandler.RespondWithJSON(w, 401, helper.ReplayedRequest, []map[string]interface{}{})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticatedClientID the api client of the Basic auth, or the client which issued the token
+func authenticatedClientID(r *http.Request) string {
+	if client, ok := r.Context().Value(helper.Client).(map[string]interface{}); ok {
+		clientID, _ := client["client_id"].(string)
+		return clientID
+	}
+	claim, _ := r.Context().Value(helper.Token).(map[string]interface{})
+	clientID, _ := claim["client_id"].(string)
+
+	return clientID
+}
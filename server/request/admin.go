@@ -0,0 +1,34 @@
+package request
+
+// AdminTokenRequest ...
+type AdminTokenRequest struct {
+	// Operator the identity of the operator authenticated by the api client, recorded in the token
+	// and as the actor of every action
+	Operator string `json:"operator" validate:"required,max=100"`
+	ClientID string `json:"-"`
+}
+
+// AdminWalletRequest ...
+type AdminWalletRequest struct {
+	CustomerxID string `json:"customer_xid"`
+	WalletID    string `json:"wallet_id"`
+	Status      string `json:"status"`
+	Cursor      string `json:"cursor"`
+	Limit       int    `json:"limit"`
+}
+
+// AdminStatusRequest ...
+type AdminStatusRequest struct {
+	Status string `json:"status" validate:"required"`
+	Reason string `json:"reason" validate:"required"`
+	// FrozenUntil RFC3339 expiry of a freeze, without it the freeze lasts until an operator lifts it
+	FrozenUntil    string `json:"frozen_until"`
+	AcceptDeposits bool   `json:"accept_deposits"`
+}
+
+// AdminCloseRequest ...
+type AdminCloseRequest struct {
+	ReferenceID string `json:"reference_id" validate:"required_with=Destination"`
+	Destination string `json:"destination"`
+	Reason      string `json:"reason" validate:"required"`
+}
@@ -5,3 +5,17 @@ type BalanceRequest struct {
 	ReferenceID string `json:"reference_id" validate:"required"`
 	CustomerxID string `json:"customer_xid"`
 }
+
+// TransactionRequest ...
+type TransactionRequest struct {
+	CustomerxID string `json:"customer_xid"`
+	Limit       int    `json:"limit"`
+	Cursor      string `json:"cursor"`
+	Type        string `json:"type"`
+	Status      string `json:"status"`
+	StartDate   string `json:"start_date"`
+	EndDate     string `json:"end_date"`
+	Sort        string `json:"sort"`
+	// AllOwners list the transactions of every wallet, only set by the admin api
+	AllOwners bool `json:"-"`
+}
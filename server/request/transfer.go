@@ -0,0 +1,9 @@
+package request
+
+// TransferRequest ...
+type TransferRequest struct {
+	ToCustomerxID string `json:"to_customer_xid" validate:"required"`
+	Amount        int    `json:"amount" validate:"required,min=10000"`
+	ReferenceID   string `json:"reference_id" validate:"required"`
+	CustomerxID   string `json:"customer_xid"`
+}
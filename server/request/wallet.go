@@ -3,6 +3,12 @@ package request
 // WalletInitRequest ...
 type WalletInitRequest struct {
 	CustomerxID string `json:"customer_xid" validate:"required"`
+	// Scopes reduce the scopes of the token, defaults to every scope of the client
+	Scopes       []string `json:"scopes"`
+	UserAgent    string   `json:"-"`
+	IP           string   `json:"-"`
+	ClientID     string   `json:"-"`
+	ClientScopes []string `json:"-"`
 }
 
 // WalletUpdateRequest ...
@@ -11,4 +17,20 @@ type WalletUpdateRequest struct {
 	Status      string `json:"status"`
 	EnabledAt   string `json:"enabled_at"`
 	DisabledAt  string `json:"disabled_at"`
+	// FrozenUntil and AcceptDeposits only apply to the frozen status
+	FrozenUntil    string `json:"frozen_until"`
+	AcceptDeposits bool   `json:"accept_deposits"`
+}
+
+// WalletCloseRequest a remaining balance is paid out to the destination with a withdrawal of the reference id
+type WalletCloseRequest struct {
+	CustomerxID string `json:"-"`
+	ReferenceID string `json:"reference_id" validate:"required_with=Destination"`
+	Destination string `json:"destination"`
+	Reason      string `json:"reason"`
+}
+
+// RevokeRequest ...
+type RevokeRequest struct {
+	CustomerxID string `json:"customer_xid" validate:"required"`
 }
@@ -0,0 +1,337 @@
+package usecase
+
+import (
+	"errors"
+	"julo-backend/helper"
+	"julo-backend/model"
+	"julo-backend/pkg/logruslogger"
+	"julo-backend/pkg/str"
+	"julo-backend/server/request"
+	"julo-backend/usecase/viewmodel"
+
+	"github.com/rs/xid"
+)
+
+// AdminUC operator actions of the admin api, changes are recorded in the audit chain and reads in
+// the access log with their actor
+type AdminUC struct {
+	*ContractUC
+	Audit viewmodel.AuditContextVM
+}
+
+// GenerateToken issue an admin token to an operator of the api client
+func (uc AdminUC) GenerateToken(req *request.AdminTokenRequest) (res viewmodel.JwtVM, err error) {
+	const (
+		ctx = "AdminUC.GenerateToken"
+	)
+
+	payload := map[string]interface{}{
+		"role":      helper.RoleAdmin,
+		"operator":  req.Operator,
+		"client_id": req.ClientID,
+		"token_id":  xid.New().String(),
+	}
+	jwePayload, err := uc.Jwe.Generate(payload)
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "jwe", uc.ReqID)
+		return res, errors.New(helper.JWT)
+	}
+	res.Token, res.ExpiredDate, err = uc.Jwt.GetAdminToken(jwePayload)
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "jwt", uc.ReqID)
+		return res, errors.New(helper.JWT)
+	}
+	err = uc.audit(helper.AuditAdminToken, "", map[string]interface{}{"token_id": payload["token_id"]})
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "audit", uc.ReqID)
+		return viewmodel.JwtVM{}, err
+	}
+
+	return res, err
+}
+
+// FindWallets search the wallets by customer, wallet id or status
+func (uc AdminUC) FindWallets(req *request.AdminWalletRequest) (res viewmodel.AdminWalletListVM, err error) {
+	const (
+		ctx = "AdminUC.FindWallets"
+	)
+
+	parameter := model.WalletParameter{
+		ID:       req.WalletID,
+		Status:   req.Status,
+		CursorID: req.Cursor,
+		Limit:    req.Limit,
+	}
+	if req.CustomerxID != "" {
+		parameter.OwnedByIndex = uc.CustomerIndex(req.CustomerxID)
+	}
+	if parameter.Limit <= 0 {
+		parameter.Limit = DefaultLimit
+	}
+	if parameter.Limit > MaxLimit {
+		parameter.Limit = MaxLimit
+	}
+	if parameter.ID != "" && !str.IsUUID(parameter.ID) {
+		return res, errors.New(helper.WalletNotFound)
+	}
+	if parameter.Status != "" && !str.Contains(WalletStatusWhitelist, parameter.Status) {
+		return res, errors.New(helper.InvalidStatus)
+	}
+	if parameter.CursorID != "" && !str.IsUUID(parameter.CursorID) {
+		return res, errors.New(helper.InvalidCursor)
+	}
+	err = uc.access(helper.AuditWalletSearch, req.WalletID, map[string]interface{}{"status": req.Status, "customer_index": parameter.OwnedByIndex})
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "access", uc.ReqID)
+		return res, err
+	}
+
+	// Fetch one extra row to know whether another page exists
+	limit := parameter.Limit
+	parameter.Limit = limit + 1
+	m := model.NewWalletModel(uc.DB, nil)
+	data, err := m.FindAll(parameter)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindAll", uc.ReqID)
+		return res, err
+	}
+
+	res.Wallets = []viewmodel.AdminWalletVM{}
+	for i, d := range data {
+		if i == limit {
+			res.NextCursor = res.Wallets[limit-1].ID
+			break
+		}
+		res.Wallets = append(res.Wallets, uc.buildWalletVM(d))
+	}
+
+	return res, err
+}
+
+// FindWallet the wallet with its most recent transactions
+func (uc AdminUC) FindWallet(id string) (res viewmodel.AdminWalletDetailVM, err error) {
+	const (
+		ctx = "AdminUC.FindWallet"
+	)
+
+	data, err := uc.findWallet(id)
+	if err != nil {
+		logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "findWallet", uc.ReqID)
+		return res, err
+	}
+	err = uc.access(helper.AuditWalletView, id, nil)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "access", uc.ReqID)
+		return res, err
+	}
+
+	res.Wallet = uc.buildWalletVM(data)
+	balanceUc := BalanceUC{ContractUC: uc.ContractUC}
+	transactions, err := balanceUc.FindTransactions(&request.TransactionRequest{CustomerxID: res.Wallet.OwnedBy, Limit: DefaultLimit})
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindTransactions", uc.ReqID)
+		return res, err
+	}
+	res.Transactions = transactions.Transactions
+
+	return res, err
+}
+
+// UpdateStatus enable, disable or freeze a wallet, enabling or disabling a frozen wallet lifts the freeze
+func (uc AdminUC) UpdateStatus(id string, req *request.AdminStatusRequest) (res viewmodel.AdminWalletVM, err error) {
+	const (
+		ctx = "AdminUC.UpdateStatus"
+	)
+
+	// A wallet is closed with Close, which settles its balance
+	if !str.Contains(WalletStatusWhitelist, req.Status) || req.Status == helper.StatusClosed {
+		return res, errors.New(helper.InvalidStatus)
+	}
+	data, err := uc.findWallet(id)
+	if err != nil {
+		logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "findWallet", uc.ReqID)
+		return res, err
+	}
+
+	audit := uc.Audit
+	audit.Reason = req.Reason
+	customerxID := uc.DecryptCustomer(model.WalletOwnedBy, data.OwnedBy)
+	walletUc := WalletUC{ContractUC: uc.ContractUC, Audit: audit, Operator: true}
+	switch req.Status {
+	case helper.StatusEnabled:
+		_, err = walletUc.Enable(customerxID)
+	case helper.StatusDisabled:
+		_, err = walletUc.Disable(customerxID)
+	case helper.StatusFrozen:
+		_, err = walletUc.Freeze(customerxID, req.FrozenUntil, req.AcceptDeposits)
+	}
+	if err != nil {
+		logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, req.Status, uc.ReqID)
+		return res, err
+	}
+	data, err = uc.findWallet(id)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "findWallet", uc.ReqID)
+		return res, err
+	}
+
+	return uc.buildWalletVM(data), err
+}
+
+// Close settle and close a wallet on behalf of its customer, a frozen wallet is only closed with a zero balance
+func (uc AdminUC) Close(id string, req *request.AdminCloseRequest) (res viewmodel.WalletCloseVM, err error) {
+	const (
+		ctx = "AdminUC.Close"
+	)
+
+	data, err := uc.findWallet(id)
+	if err != nil {
+		logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "findWallet", uc.ReqID)
+		return res, err
+	}
+
+	audit := uc.Audit
+	audit.Reason = req.Reason
+	walletUc := WalletUC{ContractUC: uc.ContractUC, Audit: audit, Operator: true}
+	res, err = walletUc.Close(&request.WalletCloseRequest{
+		CustomerxID: uc.DecryptCustomer(model.WalletOwnedBy, data.OwnedBy),
+		ReferenceID: req.ReferenceID,
+		Destination: req.Destination,
+	})
+	if err != nil {
+		logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "Close", uc.ReqID)
+		return res, err
+	}
+
+	return res, err
+}
+
+// FindPendingOperations the pending deposits and withdrawals of every wallet, the oldest first
+func (uc AdminUC) FindPendingOperations(cursor string, limit int) (res viewmodel.TransactionListVM, err error) {
+	const (
+		ctx = "AdminUC.FindPendingOperations"
+	)
+
+	err = uc.access(helper.AuditPendingView, "", map[string]interface{}{"cursor": cursor})
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "access", uc.ReqID)
+		return res, err
+	}
+	balanceUc := BalanceUC{ContractUC: uc.ContractUC}
+	res, err = balanceUc.FindTransactions(&request.TransactionRequest{
+		AllOwners: true,
+		Status:    helper.StatusPending,
+		Sort:      AscSort,
+		Cursor:    cursor,
+		Limit:     limit,
+	})
+	if err != nil {
+		logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "FindTransactions", uc.ReqID)
+		return res, err
+	}
+
+	return res, err
+}
+
+// RevokeSessions terminate every session of a customer
+func (uc AdminUC) RevokeSessions(customerxID string) (err error) {
+	const (
+		ctx = "AdminUC.RevokeSessions"
+	)
+
+	jwtUc := JwtUC{ContractUC: uc.ContractUC}
+	err = jwtUc.RevokeAll(customerxID)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "RevokeAll", uc.ReqID)
+		return err
+	}
+	err = uc.audit(helper.AuditSessionsRevoke, "", map[string]interface{}{"customer_index": uc.CustomerIndex(customerxID)})
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "audit", uc.ReqID)
+		return err
+	}
+
+	return err
+}
+
+// FindAuditEvents ...
+func (uc AdminUC) FindAuditEvents(parameter model.AuditParameter, cursor string) (res viewmodel.AuditEventListVM, err error) {
+	const (
+		ctx = "AdminUC.FindAuditEvents"
+	)
+
+	if parameter.WalletID != "" && !str.IsUUID(parameter.WalletID) {
+		return res, errors.New(helper.WalletNotFound)
+	}
+	err = uc.access(helper.AuditSearch, parameter.WalletID, map[string]interface{}{"actor": parameter.Actor, "action": parameter.Action})
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "access", uc.ReqID)
+		return res, err
+	}
+	auditUc := AuditUC{ContractUC: uc.ContractUC}
+	res, err = auditUc.FindAll(parameter, cursor)
+	if err != nil {
+		logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "FindAll", uc.ReqID)
+		return res, err
+	}
+
+	return res, err
+}
+
+func (uc AdminUC) findWallet(id string) (data model.WalletEntity, err error) {
+	if !str.IsUUID(id) {
+		return data, errors.New(helper.WalletNotFound)
+	}
+
+	m := model.NewWalletModel(uc.DB, nil)
+	data, err = m.FindByID(id)
+	if err != nil {
+		return data, err
+	}
+	if data.ID == "" {
+		return data, errors.New(helper.WalletNotFound)
+	}
+
+	return data, err
+}
+
+func (uc AdminUC) buildWalletVM(data model.WalletEntity) viewmodel.AdminWalletVM {
+	return viewmodel.AdminWalletVM{
+		ID:              data.ID,
+		OwnedBy:         uc.DecryptCustomer(model.WalletOwnedBy, data.OwnedBy),
+		Status:          walletStatus(data),
+		Balance:         data.Balance,
+		EnabledAt:       data.EnabledAt.String,
+		DisabledAt:      data.DisabledAt.String,
+		CreatedByClient: data.CreatedByClient.String,
+		FrozenReason:    data.FrozenReason.String,
+		FrozenUntil:     data.FrozenUntil.String,
+		AcceptDeposits:  data.FrozenAcceptsDeposit,
+		ClosedAt:        data.ClosedAt.String,
+		ClosedReason:    data.ClosedReason.String,
+		RetainUntil:     data.RetainUntil.String,
+		ClosingPayoutID: data.ClosingPayoutID.String,
+	}
+}
+
+// audit record an operator action in its own transaction. Customer ids are never recorded in plain.
+func (uc AdminUC) audit(action, walletID string, detail map[string]interface{}) (err error) {
+	tx := model.SQLDBTx{DB: uc.DB}
+	txFunc, err := tx.TxBegin()
+	if err != nil {
+		return err
+	}
+
+	return txFunc.TxEnd(func() error {
+		auditUc := AuditUC{ContractUC: uc.ContractUC, Tx: txFunc.DB}
+		return auditUc.Record(uc.Audit, action, walletID, nil, detail)
+	})
+}
+
+// access record an operator read, a read is only served once recorded. Customer ids are never
+// recorded in plain.
+func (uc AdminUC) access(action, walletID string, detail map[string]interface{}) (err error) {
+	auditUc := AuditUC{ContractUC: uc.ContractUC}
+
+	return auditUc.RecordAccess(uc.Audit, action, walletID, detail)
+}
@@ -0,0 +1,240 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"julo-backend/helper"
+	"julo-backend/model"
+	"julo-backend/pkg/logruslogger"
+	"julo-backend/pkg/str"
+	"julo-backend/usecase/viewmodel"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+// ApiClientUC registry of the clients allowed to call the client endpoints
+type ApiClientUC struct {
+	*ContractUC
+}
+
+// Create register a client with a new secret, the secret is only returned here
+func (uc ApiClientUC) Create(name string, scopes []string) (res viewmodel.ApiClientCredentialVM, err error) {
+	const (
+		ctx = "ApiClientUC.Create"
+	)
+
+	for _, scope := range scopes {
+		if !str.Contains(ClientScopeWhitelist, scope) {
+			return res, errors.New(helper.InvalidScope)
+		}
+	}
+
+	secret, err := generateClientSecret()
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "generateClientSecret", uc.ReqID)
+		return res, err
+	}
+
+	clientID := xid.New().String()
+	signingSecret, err := uc.Aes.Encrypt(secret, signingSecretAAD(clientID))
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Encrypt", uc.ReqID)
+		return res, err
+	}
+
+	body := model.ApiClientEntity{
+		ClientID:      clientID,
+		Name:          name,
+		SecretHash:    hashClientSecret(secret),
+		SigningSecret: sql.NullString{String: signingSecret, Valid: true},
+		Scopes:        scopes,
+		Enabled:       true,
+	}
+	m := model.NewApiClientModel(uc.DB, nil)
+	_, err = m.Store(body)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Store", uc.ReqID)
+		return res, err
+	}
+	res = viewmodel.ApiClientCredentialVM{ClientID: body.ClientID, ClientSecret: secret}
+
+	return res, err
+}
+
+// Authenticate check the credentials of an enabled client
+func (uc ApiClientUC) Authenticate(clientID, secret string) (res viewmodel.ApiClientVM, err error) {
+	const (
+		ctx = "ApiClientUC.Authenticate"
+	)
+
+	m := model.NewApiClientModel(uc.DB, nil)
+	data, err := m.FindByClientID(clientID)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindByClientID", uc.ReqID)
+		return res, err
+	}
+
+	// The hash is compared even for an unknown client so both fail in the same time
+	hash := hashClientSecret(secret)
+	match := subtle.ConstantTimeCompare([]byte(hash), []byte(data.SecretHash)) == 1
+	if data.ID == "" || !match || !data.Enabled {
+		logruslogger.Log(logruslogger.InfoLevel, clientID, ctx, "invalid_client", uc.ReqID)
+		return res, errors.New(helper.InvalidClient)
+	}
+
+	return buildApiClientVM(data), err
+}
+
+// SigningSecret the secret of an enabled client to verify its request signatures with,
+// clients created before request signing must rotate their secret first
+func (uc ApiClientUC) SigningSecret(clientID string) (res string, err error) {
+	const (
+		ctx = "ApiClientUC.SigningSecret"
+	)
+
+	m := model.NewApiClientModel(uc.DB, nil)
+	data, err := m.FindByClientID(clientID)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindByClientID", uc.ReqID)
+		return res, err
+	}
+	if data.ID == "" || !data.Enabled || !data.SigningSecret.Valid {
+		logruslogger.Log(logruslogger.InfoLevel, clientID, ctx, "invalid_client", uc.ReqID)
+		return res, errors.New(helper.InvalidClient)
+	}
+
+	res, err = uc.Aes.Decrypt(data.SigningSecret.String, signingSecretAAD(clientID))
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Decrypt", uc.ReqID)
+		return res, errors.New(helper.InvalidClient)
+	}
+
+	return res, err
+}
+
+// UseNonce record the nonce of a signed request, false when it was already used within the ttl
+func (uc ApiClientUC) UseNonce(clientID, nonce string, ttl time.Duration) (ok bool, err error) {
+	const (
+		ctx = "ApiClientUC.UseNonce"
+	)
+
+	ok, err = uc.Redis.SetNX("requestNonce"+clientID+":"+nonce, 1, ttl).Result()
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "redis_setnx", uc.ReqID)
+		return false, err
+	}
+
+	return ok, err
+}
+
+// FindAll ...
+func (uc ApiClientUC) FindAll() (res []viewmodel.ApiClientVM, err error) {
+	const (
+		ctx = "ApiClientUC.FindAll"
+	)
+
+	m := model.NewApiClientModel(uc.DB, nil)
+	data, err := m.FindAll()
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindAll", uc.ReqID)
+		return res, err
+	}
+
+	res = []viewmodel.ApiClientVM{}
+	for _, d := range data {
+		res = append(res, buildApiClientVM(d))
+	}
+
+	return res, err
+}
+
+// SetEnabled a disabled client is rejected on its next request
+func (uc ApiClientUC) SetEnabled(clientID string, enabled bool) (err error) {
+	const (
+		ctx = "ApiClientUC.SetEnabled"
+	)
+
+	m := model.NewApiClientModel(uc.DB, nil)
+	id, err := m.UpdateEnabled(clientID, enabled)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "UpdateEnabled", uc.ReqID)
+		return err
+	}
+	if id == "" {
+		return errors.New(helper.ClientNotFound)
+	}
+
+	return err
+}
+
+// RotateSecret issue a new secret, the previous one stops working at once
+func (uc ApiClientUC) RotateSecret(clientID string) (res viewmodel.ApiClientCredentialVM, err error) {
+	const (
+		ctx = "ApiClientUC.RotateSecret"
+	)
+
+	secret, err := generateClientSecret()
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "generateClientSecret", uc.ReqID)
+		return res, err
+	}
+
+	signingSecret, err := uc.Aes.Encrypt(secret, signingSecretAAD(clientID))
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Encrypt", uc.ReqID)
+		return res, err
+	}
+
+	m := model.NewApiClientModel(uc.DB, nil)
+	id, err := m.UpdateSecret(clientID, hashClientSecret(secret), signingSecret)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "UpdateSecret", uc.ReqID)
+		return res, err
+	}
+	if id == "" {
+		return res, errors.New(helper.ClientNotFound)
+	}
+	res = viewmodel.ApiClientCredentialVM{ClientID: clientID, ClientSecret: secret}
+
+	return res, err
+}
+
+// generateClientSecret 256 bits of randomness
+func generateClientSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// signingSecretAAD binds the stored signing secret to its client, it can not be copied to another row
+func signingSecretAAD(clientID string) string {
+	return "api_client.signing_secret:" + clientID
+}
+
+// hashClientSecret the secrets are random so a plain SHA-256 is enough, no key stretching is needed
+func hashClientSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(h[:])
+}
+
+func buildApiClientVM(data model.ApiClientEntity) viewmodel.ApiClientVM {
+	return viewmodel.ApiClientVM{
+		ID:         data.ID,
+		ClientID:   data.ClientID,
+		Name:       data.Name,
+		Scopes:     data.Scopes,
+		Enabled:    data.Enabled,
+		CreatedAt:  data.CreatedAt,
+		DisabledAt: data.DisabledAt.String,
+	}
+}
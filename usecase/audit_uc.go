@@ -0,0 +1,306 @@
+package usecase
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"julo-backend/helper"
+	"julo-backend/model"
+	"julo-backend/pkg/logruslogger"
+	"julo-backend/pkg/str"
+	"julo-backend/usecase/viewmodel"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditGenesisHash previous hash of the first event of a chain
+var AuditGenesisHash = strings.Repeat("0", 64)
+
+// AuditSystemChain chain of the events of no wallet
+const AuditSystemChain = "system"
+
+// AuditUC append-only audit chains, one per wallet. Every event carries the hash of the previous
+// event of its chain so a modified, removed or reordered event breaks the chain.
+type AuditUC struct {
+	*ContractUC
+	Tx *sql.Tx
+}
+
+// Record append an event, must be called with the transaction of the change so both are committed
+// together. The chain of the wallet is locked from here until the transaction ends, the writers of
+// a wallet already hold its row so only the events of no wallet wait on each other.
+func (uc AuditUC) Record(audit viewmodel.AuditContextVM, action, walletID string, before, after interface{}) (err error) {
+	const (
+		ctx = "AuditUC.Record"
+	)
+
+	if uc.Tx == nil {
+		return errors.New(helper.InternalServer)
+	}
+
+	chain := str.DefaultData(walletID, AuditSystemChain)
+	event := model.AuditEventEntity{
+		Chain:     nullString(chain),
+		Actor:     str.DefaultData(audit.Actor, helper.AuditActorSystem),
+		Action:    action,
+		WalletID:  nullString(walletID),
+		Reason:    nullString(audit.Reason),
+		RequestID: nullString(audit.RequestID),
+		IP:        nullString(audit.IP),
+		// postgres keeps microseconds, the hash must cover the stored value
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	if before != nil {
+		b, _ := json.Marshal(before)
+		event.Before = nullString(string(b))
+	}
+	if after != nil {
+		b, _ := json.Marshal(after)
+		event.After = nullString(string(b))
+	}
+
+	m := model.NewAuditModel(uc.DB, uc.Tx)
+	head, err := m.LockHead(chain, AuditGenesisHash)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "LockHead", uc.ReqID)
+		return err
+	}
+	event.PrevHash = head.Hash
+	event.Hash = auditHash(event)
+
+	head.Seq, err = m.Store(event)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Store", uc.ReqID)
+		return err
+	}
+	head.Hash = event.Hash
+	err = m.UpdateHead(head)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "UpdateHead", uc.ReqID)
+		return err
+	}
+
+	return err
+}
+
+// RecordAccess record an operator read in the access log, reads are not chained so they never wait
+// on the chain of a wallet
+func (uc AuditUC) RecordAccess(audit viewmodel.AuditContextVM, action, walletID string, detail map[string]interface{}) (err error) {
+	const (
+		ctx = "AuditUC.RecordAccess"
+	)
+
+	event := model.AuditEventEntity{
+		Actor:     str.DefaultData(audit.Actor, helper.AuditActorSystem),
+		Action:    action,
+		WalletID:  nullString(walletID),
+		RequestID: nullString(audit.RequestID),
+		IP:        nullString(audit.IP),
+		CreatedAt: time.Now().UTC(),
+	}
+	if detail != nil {
+		b, _ := json.Marshal(detail)
+		event.After = nullString(string(b))
+	}
+
+	_, err = model.NewAuditModel(uc.DB, nil).StoreAccess(event)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "StoreAccess", uc.ReqID)
+		return err
+	}
+
+	return err
+}
+
+// FindAll the events of a wallet, actor or action, the latest first
+func (uc AuditUC) FindAll(parameter model.AuditParameter, cursor string) (res viewmodel.AuditEventListVM, err error) {
+	const (
+		ctx = "AuditUC.FindAll"
+	)
+
+	if parameter.Limit <= 0 {
+		parameter.Limit = DefaultLimit
+	}
+	if parameter.Limit > MaxLimit {
+		parameter.Limit = MaxLimit
+	}
+	if parameter.WalletID != "" && !str.IsUUID(parameter.WalletID) {
+		return res, errors.New(helper.WalletNotFound)
+	}
+	if cursor != "" {
+		parameter.CursorSeq, err = strconv.ParseInt(cursor, 10, 64)
+		if err != nil || parameter.CursorSeq <= 0 {
+			return res, errors.New(helper.InvalidCursor)
+		}
+	}
+
+	// Fetch one extra row to know whether another page exists
+	limit := parameter.Limit
+	parameter.Limit = limit + 1
+	m := model.NewAuditModel(uc.DB, nil)
+	data, err := m.FindAll(parameter)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindAll", uc.ReqID)
+		return res, err
+	}
+
+	res.Events = []viewmodel.AuditEventVM{}
+	for i, d := range data {
+		if i == limit {
+			res.NextCursor = strconv.FormatInt(res.Events[limit-1].Seq, 10)
+			break
+		}
+		res.Events = append(res.Events, buildAuditEventVM(d))
+	}
+
+	return res, err
+}
+
+// Verify walk the legacy chain then every wallet chain in order and recompute every hash, the last
+// event of each chain must be its head. The result holds the seq of the first broken event when a
+// chain was tampered with, or of the head when events were removed from the end of its chain.
+func (uc AuditUC) Verify(batchSize int) (res viewmodel.AuditVerifyVM, err error) {
+	return uc.verify(model.NewAuditModel(uc.DB, nil), batchSize)
+}
+
+func (uc AuditUC) verify(m model.IAudit, batchSize int) (res viewmodel.AuditVerifyVM, err error) {
+	const (
+		ctx = "AuditUC.Verify"
+	)
+
+	if batchSize <= 0 {
+		batchSize = MaxLimit
+	}
+
+	// The events recorded before the chains were split form a single chain with no head
+	_, err = uc.verifyChain(m, "", batchSize, &res)
+	if err != nil {
+		return res, err
+	}
+
+	lastChain := ""
+	for {
+		heads, err := m.FindHeads(lastChain, batchSize)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindHeads", uc.ReqID)
+			return res, err
+		}
+
+		for _, head := range heads {
+			last, err := uc.verifyChain(m, head.Chain, batchSize, &res)
+			if err != nil {
+				return res, err
+			}
+			if last != head {
+				res.BrokenAt = head.Seq
+				logruslogger.Log(logruslogger.ErrorLevel, head.Chain, ctx, "head", uc.ReqID)
+				return res, errors.New(helper.AuditChainBroken)
+			}
+			res.Chains++
+			lastChain = head.Chain
+		}
+
+		if len(heads) < batchSize {
+			return res, nil
+		}
+	}
+}
+
+// verifyChain recompute the hashes of the chain, last is the latest event of the chain
+func (uc AuditUC) verifyChain(m model.IAudit, chain string, batchSize int, res *viewmodel.AuditVerifyVM) (last model.AuditHeadEntity, err error) {
+	const (
+		ctx = "AuditUC.verifyChain"
+	)
+
+	last = model.AuditHeadEntity{Chain: chain, Hash: AuditGenesisHash}
+	for {
+		data, err := m.FindAfter(chain, last.Seq, batchSize)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindAfter", uc.ReqID)
+			return last, err
+		}
+
+		for _, d := range data {
+			if d.PrevHash != last.Hash || auditHash(d) != d.Hash {
+				res.BrokenAt = d.Seq
+				logruslogger.Log(logruslogger.ErrorLevel, strconv.FormatInt(d.Seq, 10), ctx, "broken", uc.ReqID)
+				return last, errors.New(helper.AuditChainBroken)
+			}
+			res.Count++
+			if d.Seq > res.LastSeq {
+				res.LastSeq = d.Seq
+			}
+			last.Seq = d.Seq
+			last.Hash = d.Hash
+		}
+
+		if len(data) < batchSize {
+			return last, nil
+		}
+	}
+}
+
+// auditHash SHA-256 of the previous hash and every recorded field, encoded as a json array
+// so no field can run into the next one
+func auditHash(event model.AuditEventEntity) string {
+	b, _ := json.Marshal([]string{
+		event.PrevHash,
+		event.Actor,
+		event.Action,
+		event.WalletID.String,
+		event.Before.String,
+		event.After.String,
+		event.Reason.String,
+		event.RequestID.String,
+		event.IP.String,
+		event.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	h := sha256.Sum256(b)
+
+	return hex.EncodeToString(h[:])
+}
+
+func buildAuditEventVM(d model.AuditEventEntity) viewmodel.AuditEventVM {
+	res := viewmodel.AuditEventVM{
+		Seq:       d.Seq,
+		Actor:     d.Actor,
+		Action:    d.Action,
+		WalletID:  d.WalletID.String,
+		Reason:    d.Reason.String,
+		RequestID: d.RequestID.String,
+		IP:        d.IP.String,
+		CreatedAt: d.CreatedAt.Format(time.RFC3339Nano),
+		Hash:      d.Hash,
+	}
+	if d.Before.Valid {
+		res.Before = json.RawMessage(d.Before.String)
+	}
+	if d.After.Valid {
+		res.After = json.RawMessage(d.After.String)
+	}
+
+	return res
+}
+
+// walletSnapshot ...
+func walletSnapshot(d model.WalletEntity) viewmodel.WalletSnapshotVM {
+	return viewmodel.WalletSnapshotVM{
+		ID:              d.ID,
+		Status:          d.Status.String,
+		Balance:         d.Balance,
+		EnabledAt:       d.EnabledAt.String,
+		DisabledAt:      d.DisabledAt.String,
+		FrozenReason:    d.FrozenReason.String,
+		FrozenUntil:     d.FrozenUntil.String,
+		AcceptDeposits:  d.FrozenAcceptsDeposit,
+		ClosedAt:        d.ClosedAt.String,
+		ClosingPayoutID: d.ClosingPayoutID.String,
+	}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,170 @@
+package usecase
+
+import (
+	"julo-backend/helper"
+	"julo-backend/model"
+	"julo-backend/usecase/viewmodel"
+	"testing"
+	"time"
+)
+
+// testAuditModel in-memory events and chain heads, only the reads of Verify are implemented
+type testAuditModel struct {
+	model.IAudit
+	events []model.AuditEventEntity
+	heads  []model.AuditHeadEntity
+}
+
+func (m *testAuditModel) FindAfter(chain string, seq int64, limit int) (data []model.AuditEventEntity, err error) {
+	for _, d := range m.events {
+		if d.Chain.String == chain && d.Seq > seq && len(data) < limit {
+			data = append(data, d)
+		}
+	}
+
+	return data, err
+}
+
+func (m *testAuditModel) FindHeads(afterChain string, limit int) (data []model.AuditHeadEntity, err error) {
+	for _, d := range m.heads {
+		if d.Chain > afterChain && len(data) < limit {
+			data = append(data, d)
+		}
+	}
+
+	return data, err
+}
+
+// record append an event to the chain the way AuditUC.Record does
+func (m *testAuditModel) record(chain, action string) {
+	head := model.AuditHeadEntity{Chain: chain, Hash: AuditGenesisHash}
+	i := len(m.heads)
+	for j, d := range m.heads {
+		if d.Chain == chain {
+			head, i = d, j
+		}
+	}
+	if i == len(m.heads) {
+		m.heads = append(m.heads, head)
+	}
+
+	event := model.AuditEventEntity{
+		Seq:       int64(len(m.events) + 1),
+		Chain:     nullString(chain),
+		Actor:     helper.AuditActorSystem,
+		Action:    action,
+		WalletID:  nullString(chain),
+		After:     nullString(`{"balance":10000}`),
+		CreatedAt: time.Date(2026, 1, 1, 0, 0, len(m.events), 0, time.UTC),
+		PrevHash:  head.Hash,
+	}
+	event.Hash = auditHash(event)
+	m.events = append(m.events, event)
+	m.heads[i] = model.AuditHeadEntity{Chain: chain, Seq: event.Seq, Hash: event.Hash}
+}
+
+func TestAuditHash(t *testing.T) {
+	event := model.AuditEventEntity{
+		Actor:     "operator",
+		Action:    helper.AuditWalletStatus,
+		WalletID:  nullString("c4d1a3e0-8a3b-4d5e-9f6a-1b2c3d4e5f60"),
+		CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 1000, time.UTC),
+		PrevHash:  AuditGenesisHash,
+	}
+	hash := auditHash(event)
+	if len(hash) != 64 {
+		t.Fatalf("hash %s", hash)
+	}
+
+	// The hash does not depend on the time zone the time was read in
+	local := event
+	local.CreatedAt = event.CreatedAt.In(time.FixedZone("WIB", 7*3600))
+	if auditHash(local) != hash {
+		t.Error("hash changed with the time zone")
+	}
+
+	changes := map[string]func(e *model.AuditEventEntity){
+		"prev_hash":  func(e *model.AuditEventEntity) { e.PrevHash = hash },
+		"actor":      func(e *model.AuditEventEntity) { e.Actor = "operator2" },
+		"wallet_id":  func(e *model.AuditEventEntity) { e.WalletID = nullString("") },
+		"after":      func(e *model.AuditEventEntity) { e.After = nullString("{}") },
+		"created_at": func(e *model.AuditEventEntity) { e.CreatedAt = e.CreatedAt.Add(time.Microsecond) },
+		// A field can not run into the next one
+		"boundary": func(e *model.AuditEventEntity) { e.Actor, e.Action = e.Actor+e.Action[:1], e.Action[1:] },
+	}
+	for name, change := range changes {
+		changed := event
+		change(&changed)
+		if auditHash(changed) == hash {
+			t.Errorf("%s: hash unchanged", name)
+		}
+	}
+}
+
+func TestAuditVerify(t *testing.T) {
+	const (
+		walletA = "1b7e0d8c-4a43-4c6e-bd32-2f1e6f3d9a01"
+		walletB = "9c3f2a1d-0e6b-4f7a-8d5c-3e2b1a0f9c02"
+	)
+
+	tests := []struct {
+		name     string
+		tamper   func(m *testAuditModel)
+		brokenAt int64
+	}{
+		{
+			name:   "intact",
+			tamper: func(m *testAuditModel) {},
+		},
+		{
+			name:     "modified row",
+			tamper:   func(m *testAuditModel) { m.events[2].After = nullString(`{"balance":99999}`) },
+			brokenAt: 3,
+		},
+		{
+			name: "removed row",
+			tamper: func(m *testAuditModel) {
+				m.events = append(m.events[:1:1], m.events[2:]...)
+			},
+			brokenAt: 4,
+		},
+		{
+			name:     "removed tail row",
+			tamper:   func(m *testAuditModel) { m.events = m.events[:len(m.events)-1] },
+			brokenAt: 6,
+		},
+		{
+			name:     "removed chain",
+			tamper:   func(m *testAuditModel) { m.events = m.events[:0] },
+			brokenAt: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &testAuditModel{}
+			for _, chain := range []string{walletA, walletA, walletB, walletA, walletB, AuditSystemChain} {
+				m.record(chain, helper.AuditBalancePosted)
+			}
+			tt.tamper(m)
+
+			uc := AuditUC{ContractUC: &ContractUC{}}
+			res, err := uc.verify(m, 2)
+			if tt.brokenAt == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := viewmodel.AuditVerifyVM{Count: 6, Chains: 3, LastSeq: 6}
+				if res != want {
+					t.Errorf("result %+v, want %+v", res, want)
+				}
+				return
+			}
+			if err == nil || err.Error() != helper.AuditChainBroken {
+				t.Fatalf("error %v, want %s", err, helper.AuditChainBroken)
+			}
+			if res.BrokenAt != tt.brokenAt {
+				t.Errorf("broken at %d, want %d", res.BrokenAt, tt.brokenAt)
+			}
+		})
+	}
+}
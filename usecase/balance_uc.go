@@ -2,20 +2,25 @@ package usecase
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"julo-backend/helper"
 	"julo-backend/model"
 	"julo-backend/pkg/amqp"
+	"julo-backend/pkg/interfacepkg"
 	"julo-backend/pkg/logruslogger"
+	"julo-backend/pkg/str"
 	"julo-backend/server/request"
 	"julo-backend/usecase/viewmodel"
+	"strings"
 	"time"
 )
 
 // BalanceUC ...
 type BalanceUC struct {
 	*ContractUC
-	Tx *sql.Tx
+	Tx    *sql.Tx
+	Audit viewmodel.AuditContextVM
 }
 
 func (uc *BalanceUC) Deposit(req *request.BalanceRequest) (res viewmodel.DepositVM, err error) {
@@ -44,23 +49,56 @@ func (uc *BalanceUC) Deposit(req *request.BalanceRequest) (res viewmodel.Deposit
 		DepositedAt: now,
 	}
 
-	res.Deposit.ID, err = m.StoreDe(res.Deposit)
+	// The owner is stored encrypted, the response keeps the plain id
+	stored := res.Deposit
+	var depositedByIndex string
+	stored.DepositedBy, depositedByIndex, err = uc.EncryptCustomer(model.BalanceDepositedBy, req.CustomerxID)
 	if err != nil {
-		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "StoreDe", uc.ReqID)
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "EncryptCustomer", uc.ReqID)
 		return res, err
 	}
 
-	err = uc.sendQueue(viewmodel.SendQueue{
-		OwnedBy:   req.CustomerxID,
-		Amount:    req.Amount,
-		Type:      helper.TypeDeposit,
-		BalanceID: res.Deposit.ID,
-	})
+	// The balance row and its queue message are committed together, the outbox relay publishes the message
+	tx := model.SQLDBTx{DB: uc.DB}
+	txFunc, err := tx.TxBegin()
 	if err != nil {
-		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "sendQueue", uc.ReqID)
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "TxBegin", uc.ReqID)
 		return res, err
 	}
 
+	err = txFunc.TxEnd(func() error {
+		m := model.NewBalanceModel(uc.DB, txFunc.DB)
+		res.Deposit.ID, err = m.StoreDe(stored, depositedByIndex)
+		if model.IsUniqueViolation(err) {
+			// A concurrent request with the same reference was stored first
+			logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "ReferenceExist", uc.ReqID)
+			return errors.New(helper.ReferenceExist)
+		}
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "StoreDe", uc.ReqID)
+			return err
+		}
+
+		err = uc.storeQueue(txFunc.DB, viewmodel.SendQueue{
+			OwnedByIndex: depositedByIndex,
+			Amount:       req.Amount,
+			Type:         helper.TypeDeposit,
+			BalanceID:    res.Deposit.ID,
+		})
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "storeQueue", uc.ReqID)
+			return err
+		}
+
+		return uc.auditRequest(txFunc.DB, helper.AuditDepositRequest, depositedByIndex, viewmodel.OperationSnapshotVM{
+			ID:          res.Deposit.ID,
+			Type:        helper.TypeDeposit,
+			Amount:      req.Amount,
+			ReferenceID: req.ReferenceID,
+			Status:      helper.StatusPending,
+		})
+	})
+
 	return res, err
 }
 
@@ -102,26 +140,85 @@ func (uc *BalanceUC) Withdrawal(req *request.BalanceRequest) (res viewmodel.With
 		WithdrawnAt: now,
 	}
 
-	res.Withdrawal.ID, err = m.StoreWd(res.Withdrawal)
+	// The owner is stored encrypted, the response keeps the plain id
+	stored := res.Withdrawal
+	var withdrawnByIndex string
+	stored.WithdrawnBy, withdrawnByIndex, err = uc.EncryptCustomer(model.BalanceWithdrawnBy, req.CustomerxID)
 	if err != nil {
-		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "StoreWd", uc.ReqID)
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "EncryptCustomer", uc.ReqID)
 		return res, err
 	}
 
-	err = uc.sendQueue(viewmodel.SendQueue{
-		OwnedBy:   req.CustomerxID,
-		Amount:    req.Amount,
-		Type:      helper.TypeWithdrawal,
-		BalanceID: res.Withdrawal.ID,
-	})
+	tx := model.SQLDBTx{DB: uc.DB}
+	txFunc, err := tx.TxBegin()
 	if err != nil {
-		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "sendQueue", uc.ReqID)
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "TxBegin", uc.ReqID)
 		return res, err
 	}
 
+	err = txFunc.TxEnd(func() error {
+		m := model.NewBalanceModel(uc.DB, txFunc.DB)
+		res.Withdrawal.ID, err = m.StoreWd(stored, withdrawnByIndex)
+		if model.IsUniqueViolation(err) {
+			// A concurrent request with the same reference was stored first
+			logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "ReferenceExist", uc.ReqID)
+			return errors.New(helper.ReferenceExist)
+		}
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "StoreWd", uc.ReqID)
+			return err
+		}
+
+		err = uc.storeQueue(txFunc.DB, viewmodel.SendQueue{
+			OwnedByIndex: withdrawnByIndex,
+			Amount:       req.Amount,
+			Type:         helper.TypeWithdrawal,
+			BalanceID:    res.Withdrawal.ID,
+		})
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "storeQueue", uc.ReqID)
+			return err
+		}
+
+		return uc.auditRequest(txFunc.DB, helper.AuditWithdrawalRequest, withdrawnByIndex, viewmodel.OperationSnapshotVM{
+			ID:          res.Withdrawal.ID,
+			Type:        helper.TypeWithdrawal,
+			Amount:      req.Amount,
+			ReferenceID: req.ReferenceID,
+			Status:      helper.StatusPending,
+		})
+	})
+
 	return res, err
 }
 
+// auditRequest check the wallet accepts the requested operation and record it against the wallet,
+// the balance is unchanged until it is posted
+func (uc BalanceUC) auditRequest(tx *sql.Tx, action, ownedByIndex string, operation viewmodel.OperationSnapshotVM) (err error) {
+	const (
+		ctx = "BalanceUC.auditRequest"
+	)
+
+	wallet, err := model.NewWalletModel(uc.DB, tx).FindByOwenForUpdate(ownedByIndex)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindByOwenForUpdate", uc.ReqID)
+		return err
+	}
+	if wallet.ID == "" {
+		return errors.New(helper.WalletNotFound)
+	}
+	err = walletAccepts(wallet, operation.Type)
+	if err != nil {
+		return err
+	}
+
+	after := walletSnapshot(wallet)
+	after.Operation = &operation
+	auditUc := AuditUC{ContractUC: uc.ContractUC, Tx: tx}
+
+	return auditUc.Record(uc.Audit, action, wallet.ID, walletSnapshot(wallet), after)
+}
+
 func (uc BalanceUC) UpdateStatus(id, status string) (err error) {
 	const (
 		ctx = "UpdateStatus"
@@ -137,23 +234,317 @@ func (uc BalanceUC) UpdateStatus(id, status string) (err error) {
 	return err
 }
 
-func (uc BalanceUC) sendQueue(req viewmodel.SendQueue) (err error) {
+// FindDeposit find a deposit of the caller by id or reference id
+func (uc BalanceUC) FindDeposit(customerxID, id, referenceID string) (res viewmodel.DepositVM, err error) {
 	const (
-		ctx = "sendQueue"
+		ctx = "BalanceUC.FindDeposit"
 	)
 
-	mqueue := amqp.NewQueue(AmqpConnection, AmqpChannel)
-	queueBody := map[string]interface{}{
-		"qid":        uc.ContractUC.ReqID,
-		"owned_by":   req.OwnedBy,
-		"amount":     req.Amount,
-		"type":       req.Type,
-		"balance_id": req.BalanceID,
+	data, err := uc.findOne(customerxID, id, referenceID, helper.TypeDeposit)
+	if err != nil {
+		logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "findOne", uc.ReqID)
+		return res, err
+	}
+
+	res.Deposit = viewmodel.DepositResp{
+		ID:            data.ID,
+		DepositedBy:   uc.DecryptCustomer(model.BalanceDepositedBy, data.DepositedBy.String),
+		Status:        data.Status,
+		DepositedAt:   data.DepositedAt.String,
+		Amount:        data.Amount,
+		ReferenceID:   data.ReferenceID,
+		FailureReason: data.FailureReason.String,
 	}
-	AmqpConnection, AmqpChannel, err = mqueue.PushQueueReconnect(uc.ContractUC.EnvConfig["AMQP_URL"], queueBody, amqp.UpdateBalance, amqp.UpdateBalanceDeadLetter)
+
+	return res, err
+}
+
+// FindWithdrawal find a withdrawal of the caller by id or reference id
+func (uc BalanceUC) FindWithdrawal(customerxID, id, referenceID string) (res viewmodel.WithdrawalVM, err error) {
+	const (
+		ctx = "BalanceUC.FindWithdrawal"
+	)
+
+	data, err := uc.findOne(customerxID, id, referenceID, helper.TypeWithdrawal)
+	if err != nil {
+		logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "findOne", uc.ReqID)
+		return res, err
+	}
+
+	res.Withdrawal = viewmodel.WithdrawalResp{
+		ID:            data.ID,
+		WithdrawnBy:   uc.DecryptCustomer(model.BalanceWithdrawnBy, data.WithdrawnBy.String),
+		Status:        data.Status,
+		WithdrawnAt:   data.WithdrawnAt.String,
+		Amount:        data.Amount,
+		ReferenceID:   data.ReferenceID,
+		FailureReason: data.FailureReason.String,
+	}
+
+	return res, err
+}
+
+func (uc BalanceUC) findOne(customerxID, id, referenceID, types string) (data model.BalanceEntity, err error) {
+	const (
+		ctx = "BalanceUC.findOne"
+	)
+
+	m := model.NewBalanceModel(uc.DB, uc.Tx)
+	if id != "" {
+		if !str.IsUUID(id) {
+			return data, errors.New(helper.InvalidID)
+		}
+		data, err = m.FindByID(id, uc.CustomerIndex(customerxID), types)
+	} else {
+		if !str.IsUUID(referenceID) {
+			return data, errors.New(helper.InvalidID)
+		}
+		data, err = m.FindByReferenceID(referenceID, uc.CustomerIndex(customerxID), types)
+	}
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "find", uc.ReqID)
+		return data, err
+	}
+	if data.ID == "" {
+		return data, errors.New(helper.BalanceNotFound)
+	}
+
+	return data, err
+}
+
+// FindTransactions ...
+func (uc BalanceUC) FindTransactions(req *request.TransactionRequest) (res viewmodel.TransactionListVM, err error) {
+	const (
+		ctx = "BalanceUC.FindTransactions"
+	)
+
+	if req.CustomerxID == "" && !req.AllOwners {
+		return res, errors.New(helper.WalletNotFound)
+	}
+	ownedByIndex := ""
+	if !req.AllOwners {
+		ownedByIndex = uc.CustomerIndex(req.CustomerxID)
+	}
+
+	parameter := model.BalanceParameter{
+		OwnedByIndex: ownedByIndex,
+		Type:         req.Type,
+		Status:       req.Status,
+		Sort:         strings.ToLower(str.DefaultData(req.Sort, DescSort)),
+		Limit:        req.Limit,
+	}
+	if parameter.Limit <= 0 {
+		parameter.Limit = DefaultLimit
+	}
+	if parameter.Limit > MaxLimit {
+		parameter.Limit = MaxLimit
+	}
+	if !str.Contains(SortWhitelist, parameter.Sort) {
+		return res, errors.New(helper.InvalidSort)
+	}
+	if parameter.Status != "" && !str.Contains(BalanceStatusWhitelist, parameter.Status) {
+		return res, errors.New(helper.InvalidStatus)
+	}
+	if parameter.Type != "" && !str.Contains([]string{helper.TypeDeposit, helper.TypeWithdrawal, helper.TypeTransfer}, parameter.Type) {
+		return res, errors.New(helper.InvalidType)
+	}
+
+	if req.StartDate != "" {
+		parameter.StartDate, err = parseFilterDate(req.StartDate, false)
+		if err != nil {
+			logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "parse_start_date", uc.ReqID)
+			return res, errors.New(helper.InvalidDate)
+		}
+	}
+	if req.EndDate != "" {
+		parameter.EndDate, err = parseFilterDate(req.EndDate, true)
+		if err != nil {
+			logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "parse_end_date", uc.ReqID)
+			return res, errors.New(helper.InvalidDate)
+		}
+	}
+	if req.Cursor != "" {
+		parameter.CursorDate, parameter.CursorID, err = decodeCursor(req.Cursor)
+		if err != nil {
+			logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "decode_cursor", uc.ReqID)
+			return res, errors.New(helper.InvalidCursor)
+		}
+	}
+
+	// Fetch one extra row to know whether another page exists
+	limit := parameter.Limit
+	parameter.Limit = limit + 1
+	m := model.NewBalanceModel(uc.DB, uc.Tx)
+	data, err := m.FindAllByOwner(parameter)
 	if err != nil {
-		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "update_balance_queue", uc.ReqID)
-		return errors.New("update_balance_queue")
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindAllByOwner", uc.ReqID)
+		return res, err
+	}
+
+	res.Transactions = []viewmodel.TransactionVM{}
+	for i, d := range data {
+		if i == limit {
+			last := res.Transactions[limit-1]
+			res.NextCursor = encodeCursor(last.TransactedAt, last.ID)
+			break
+		}
+		res.Transactions = append(res.Transactions, uc.buildTransactionVM(d))
+	}
+
+	return res, err
+}
+
+func (uc BalanceUC) buildTransactionVM(d model.TransactionEntity) viewmodel.TransactionVM {
+	res := viewmodel.TransactionVM{
+		ID:            d.ID,
+		Type:          d.Type,
+		Status:        d.Status,
+		Amount:        d.Amount,
+		ReferenceID:   d.ReferenceID,
+		FailureReason: d.FailureReason.String,
+	}
+	switch d.Type {
+	case helper.TypeDeposit:
+		res.TransactedBy = uc.DecryptCustomer(model.BalanceDepositedBy, d.DepositedBy.String)
+		res.TransactedAt = d.DepositedAt.String
+	case helper.TypeTransfer:
+		// Transfer rows are read from the transfer table
+		res.TransactedBy = uc.DecryptCustomer(model.TransferTransferredBy, d.WithdrawnBy.String)
+		res.ReceivedBy = uc.DecryptCustomer(model.TransferReceivedBy, d.DepositedBy.String)
+		res.TransactedAt = d.WithdrawnAt.String
+	default:
+		res.TransactedBy = uc.DecryptCustomer(model.BalanceWithdrawnBy, d.WithdrawnBy.String)
+		res.TransactedAt = d.WithdrawnAt.String
+	}
+
+	return res
+}
+
+// parseFilterDate accepts either a date (2006-01-02) or a RFC3339 timestamp,
+// a plain end date is treated as inclusive of the whole day
+func parseFilterDate(value string, isEnd bool) (string, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t.Format(time.RFC3339Nano), nil
+	}
+
+	loc, err := time.LoadLocation(DefaultLocation)
+	if err != nil {
+		return "", err
+	}
+	t, err = time.ParseInLocation("2006-01-02", value, loc)
+	if err != nil {
+		return "", err
+	}
+	if isEnd {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t.Format(time.RFC3339Nano), nil
+}
+
+func encodeCursor(date, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(date + "|" + id))
+}
+
+func decodeCursor(cursor string) (date, id string, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return date, id, err
+	}
+
+	parts := strings.Split(string(b), "|")
+	if len(parts) != 2 || parts[1] == "" {
+		return date, id, errors.New(helper.InvalidCursor)
+	}
+	if _, err = time.Parse(time.RFC3339Nano, parts[0]); err != nil {
+		return date, id, err
+	}
+
+	return parts[0], parts[1], err
+}
+
+// UpdateFailure ...
+func (uc BalanceUC) UpdateFailure(id, status, reason string) (err error) {
+	const (
+		ctx = "BalanceUC.UpdateFailure"
+	)
+
+	m := model.NewBalanceModel(uc.DB, uc.Tx)
+	err = m.UpdateFailure(id, status, reason)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "UpdateFailure", uc.ReqID)
+		return err
+	}
+
+	return err
+}
+
+// Replay move the failed balance row back to pending and write its message to the outbox in one
+// transaction, the outbox relay publishes it with publisher confirms
+func (uc BalanceUC) Replay(message viewmodel.QueueEnvelope) (err error) {
+	const (
+		ctx = "BalanceUC.Replay"
+	)
+
+	tx := model.SQLDBTx{DB: uc.DB}
+	txFunc, err := tx.TxBegin()
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "TxBegin", uc.ReqID)
+		return err
+	}
+	txDB := txFunc.DB
+
+	err = model.NewBalanceModel(uc.DB, txDB).Reopen(message.Payload.BalanceID)
+	if err != nil {
+		txDB.Rollback()
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Reopen", uc.ReqID)
+		return err
+	}
+
+	// The message is replayed as it was dead-lettered, with its correlation id. A message published
+	// before schema version 2 is upgraded so the customer id is not published again.
+	if message.Payload.OwnedByIndex == "" {
+		message.Payload.OwnedByIndex = uc.OwnerIndex(message.Payload)
+		message.Payload.OwnedBy = ""
+		message.SchemaVersion = QueueSchemaVersion
+	}
+	_, err = model.NewOutboxModel(uc.DB, txDB).Store(viewmodel.OutboxVM{
+		Queue:           amqp.UpdateBalance,
+		DeadLetterQueue: amqp.UpdateBalanceDeadLetter,
+		Payload:         interfacepkg.Marshall(message),
+	})
+	if err != nil {
+		txDB.Rollback()
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Store", uc.ReqID)
+		return err
+	}
+
+	err = txDB.Commit()
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Commit", uc.ReqID)
+		return err
+	}
+
+	return err
+}
+
+// storeQueue write the update balance message to the outbox within the given transaction
+func (uc BalanceUC) storeQueue(tx *sql.Tx, req viewmodel.SendQueue) (err error) {
+	const (
+		ctx = "storeQueue"
+	)
+
+	queueBody := NewUpdateBalanceMessage(uc.ContractUC.ReqID, req)
+	m := model.NewOutboxModel(uc.DB, tx)
+	_, err = m.Store(viewmodel.OutboxVM{
+		Queue:           amqp.UpdateBalance,
+		DeadLetterQueue: amqp.UpdateBalanceDeadLetter,
+		Payload:         interfacepkg.Marshall(queueBody),
+	})
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Store", uc.ReqID)
+		return err
 	}
 
 	return err
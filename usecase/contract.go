@@ -4,8 +4,12 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"regexp"
+	"strings"
 	"time"
 
+	"julo-backend/helper"
+	"julo-backend/model"
 	"julo-backend/pkg/aes"
 	"julo-backend/pkg/jwe"
 	"julo-backend/pkg/jwt"
@@ -36,6 +40,47 @@ var (
 	DescSort = "desc"
 	// SortWhitelist ...
 	SortWhitelist = []string{AscSort, DescSort}
+	// BalanceStatusWhitelist ...
+	BalanceStatusWhitelist = []string{helper.StatusPending, helper.StatusSuccess, helper.StatusFailed, helper.StatusReversed}
+	// OutboxBatchSize ...
+	OutboxBatchSize = 50
+	// OutboxRelayInterval ...
+	OutboxRelayInterval = time.Second
+	// OutboxClaimSeconds how long a relay owns the messages it claimed, they are claimed again
+	// by another relay when it crashes before marking them
+	OutboxClaimSeconds = 60
+	// OutboxConfirmTimeout how long the relay waits for the broker to confirm a message
+	OutboxConfirmTimeout = 5 * time.Second
+	// TokenScopeWhitelist ...
+	TokenScopeWhitelist = []string{helper.ScopeWalletRead, helper.ScopeWalletDeposit, helper.ScopeWalletWithdraw, helper.ScopeWalletManage}
+	// DefaultClientScopes ...
+	DefaultClientScopes = append([]string{helper.ScopeWalletInit, helper.ScopeSessionRevoke}, TokenScopeWhitelist...)
+	// ClientScopeWhitelist the admin scope is only granted on request
+	ClientScopeWhitelist = append([]string{helper.ScopeAdmin}, DefaultClientScopes...)
+	// WalletStatusWhitelist ...
+	WalletStatusWhitelist = []string{helper.StatusEnabled, helper.StatusDisabled, helper.StatusFrozen, helper.StatusClosed}
+	// WalletCustomerTransitions the statuses a customer can move the wallet to, a wallet never enabled has no status
+	// and a closed wallet never moves again
+	WalletCustomerTransitions = map[string][]string{
+		"":                    {helper.StatusEnabled, helper.StatusDisabled, helper.StatusClosed},
+		helper.StatusEnabled:  {helper.StatusDisabled, helper.StatusClosed},
+		helper.StatusDisabled: {helper.StatusEnabled, helper.StatusClosed},
+	}
+	// WalletOperatorTransitions only an operator freezes a wallet, lifts its freeze or closes it while frozen
+	WalletOperatorTransitions = map[string][]string{
+		"":                    {helper.StatusEnabled, helper.StatusDisabled, helper.StatusFrozen, helper.StatusClosed},
+		helper.StatusEnabled:  {helper.StatusDisabled, helper.StatusFrozen, helper.StatusClosed},
+		helper.StatusDisabled: {helper.StatusEnabled, helper.StatusFrozen, helper.StatusClosed},
+		helper.StatusFrozen:   {helper.StatusEnabled, helper.StatusDisabled, helper.StatusFrozen, helper.StatusClosed},
+	}
+	// DefaultWalletRetentionYears how long a closed wallet and its history are retained without WALLET_RETENTION_YEARS
+	DefaultWalletRetentionYears = 10
+	// PayoutDestinationRegex the payout destination of a closing wallet, <rail>:<account>
+	PayoutDestinationRegex = regexp.MustCompile(`^(bank|ewallet):[A-Za-z0-9]{4,34}$`)
+	// SignatureMaxSkew ...
+	SignatureMaxSkew = 5 * time.Minute
+	// SignatureMaxBody ...
+	SignatureMaxBody int64 = 1 << 20
 	// MinLengthPassword ...
 	MinLengthPassword = 8
 )
@@ -102,3 +147,26 @@ func (uc ContractUC) StoreToRedisExp(key string, val interface{}, duration strin
 
 	return err
 }
+
+// EncryptCustomer encrypt a customer id stored at rest in the column, the blind index is the value it is looked up with
+func (uc ContractUC) EncryptCustomer(column model.EncryptedColumn, customerxID string) (ciphertext, index string, err error) {
+	customerxID = strings.ToLower(customerxID)
+	ciphertext, err = uc.Aes.Encrypt(customerxID, column.AAD())
+
+	return ciphertext, uc.Aes.BlindIndex(customerxID), err
+}
+
+// CustomerIndex blind index of a customer id
+func (uc ContractUC) CustomerIndex(customerxID string) string {
+	return uc.Aes.BlindIndex(strings.ToLower(customerxID))
+}
+
+// CustomerActor the audit actor of a customer, identified by its blind index
+func (uc ContractUC) CustomerActor(customerxID string) string {
+	return "customer:" + uc.CustomerIndex(customerxID)
+}
+
+// DecryptCustomer decrypt a customer id read from the column
+func (uc ContractUC) DecryptCustomer(column model.EncryptedColumn, ciphertext string) string {
+	return uc.Aes.DecryptNoErr(ciphertext, column.AAD())
+}
@@ -0,0 +1,74 @@
+package usecase
+
+import (
+	"julo-backend/model"
+	"julo-backend/pkg/aes"
+	"julo-backend/pkg/logruslogger"
+	"julo-backend/pkg/str"
+)
+
+// EncryptionUC ...
+type EncryptionUC struct {
+	*ContractUC
+}
+
+// Migrate encrypt the plain customer ids of the column and re-encrypt the values of an older
+// ciphertext version, a batch is committed at a time so the migration can run on a live database
+func (uc EncryptionUC) Migrate(column model.EncryptedColumn, batchSize int) (count int, err error) {
+	const (
+		ctx = "EncryptionUC.Migrate"
+	)
+
+	for {
+		migrated := 0
+		tx := model.SQLDBTx{DB: uc.DB}
+		txFunc, err := tx.TxBegin()
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "TxBegin", uc.ReqID)
+			return count, err
+		}
+
+		err = txFunc.TxEnd(func() error {
+			m := model.NewEncryptionModel(uc.DB, txFunc.DB)
+			data, err := m.FindOutdated(column, aes.VersionAAD, batchSize)
+			if err != nil {
+				logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindOutdated", uc.ReqID)
+				return err
+			}
+
+			for _, d := range data {
+				// Customer ids are uuids, anything else is a ciphertext of an older version
+				plain := d.Value
+				if !str.IsUUID(plain) {
+					plain, err = uc.Aes.Decrypt(d.Value, column.AAD())
+					if err != nil {
+						logruslogger.Log(logruslogger.ErrorLevel, column.Table+"."+column.Column+" "+d.ID+": "+err.Error(), ctx, "Decrypt", uc.ReqID)
+						return err
+					}
+				}
+
+				ciphertext, index, err := uc.EncryptCustomer(column, plain)
+				if err != nil {
+					logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "EncryptCustomer", uc.ReqID)
+					return err
+				}
+				err = m.UpdateValue(column, d.ID, ciphertext, index)
+				if err != nil {
+					logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "UpdateValue", uc.ReqID)
+					return err
+				}
+				migrated++
+			}
+
+			return err
+		})
+		if err != nil {
+			return count, err
+		}
+
+		count += migrated
+		if migrated < batchSize {
+			return count, err
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package usecase
 
 import (
+	"encoding/json"
 	"errors"
 	"julo-backend/helper"
 	"julo-backend/pkg/logruslogger"
 	"julo-backend/usecase/viewmodel"
+	"time"
 
+	"github.com/go-redis/redis/v7"
 	"github.com/rs/xid"
 )
 
@@ -14,15 +17,167 @@ type JwtUC struct {
 	*ContractUC
 }
 
-// GenerateToken ...
-func (uc JwtUC) GenerateToken(payload map[string]interface{}, res *viewmodel.JwtVM) (err error) {
+// GenerateToken open a new session and issue its access and refresh token
+func (uc JwtUC) GenerateToken(payload map[string]interface{}, session viewmodel.SessionVM, res *viewmodel.JwtVM) (err error) {
 	ctx := "JwtUC.GenerateToken"
 
-	deviceID := xid.New().String()
-	payload["device_id"] = deviceID
-	err = uc.StoreToRedisExp("userDeviceID"+payload["customerx_id"].(string), deviceID, uc.EnvConfig["TOKEN_EXP_SECRET"]+"h")
+	now := time.Now().Format(time.RFC3339)
+	session.SessionID = xid.New().String()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	payload["session_id"] = session.SessionID
+	refreshID := xid.New().String()
+	err = uc.StoreToRedisExp("refreshID"+session.SessionID, refreshID, uc.EnvConfig["TOKEN_EXP_REFRESH_SECRET"]+"h")
 	if err != nil {
-		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "device_id", uc.ReqID)
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "refresh_id", uc.ReqID)
+		return errors.New(helper.InternalServer)
+	}
+
+	return uc.generateToken(payload, session, refreshID, res)
+}
+
+// rotateRefreshScript replace the refresh id of a session only while it is the presented one,
+// returns -1 once the refresh id expired and 0 when another one is current
+var rotateRefreshScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if not current then
+	return -1
+end
+if current ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+return 1`)
+
+// Refresh exchange a refresh token for a new token pair of the same session, the refresh
+// token is single use and presenting an already used one revokes the whole session
+func (uc JwtUC) Refresh(claim map[string]interface{}) (res viewmodel.JwtVM, err error) {
+	ctx := "JwtUC.Refresh"
+
+	customerxID, _ := claim["customerx_id"].(string)
+	sessionID, _ := claim["session_id"].(string)
+	refreshID, _ := claim["refresh_id"].(string)
+	if customerxID == "" || sessionID == "" || refreshID == "" {
+		return res, errors.New(helper.InvalidRefreshToken)
+	}
+	// A token issued before the scopes has none, its customer gets a new one from /init
+	if _, ok := claim["scopes"]; !ok {
+		return res, errors.New(helper.InvalidRefreshToken)
+	}
+
+	// A terminated session can not be brought back by refreshing
+	sessionUc := SessionUC{ContractUC: uc.ContractUC}
+	session, err := sessionUc.Find(customerxID, sessionID)
+	if err != nil {
+		uc.Redis.Del("refreshID" + sessionID)
+		return res, errors.New(helper.ExpiredSession)
+	}
+	// Every pair has its own device id, the refresh token of an earlier pair was already exchanged
+	if session.DeviceID != claim["device_id"] {
+		logruslogger.Log(logruslogger.WarnLevel, sessionID, ctx, "refresh_reuse", uc.ReqID)
+		uc.RevokeSession(customerxID, sessionID)
+		return res, errors.New(helper.RefreshTokenReused)
+	}
+
+	// Swap the current refresh id atomically so two exchanges of one token can not both succeed
+	newRefreshID := xid.New().String()
+	current, _ := json.Marshal(refreshID)
+	next, _ := json.Marshal(newRefreshID)
+	dur, _ := time.ParseDuration(uc.EnvConfig["TOKEN_EXP_REFRESH_SECRET"] + "h")
+	swapped, err := rotateRefreshScript.Run(uc.Redis, []string{"refreshID" + sessionID}, string(current), string(next), dur.Milliseconds()).Int()
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "redis_rotate", uc.ReqID)
+		return res, errors.New(helper.InternalServer)
+	}
+	if swapped == -1 {
+		return res, errors.New(helper.ExpiredSession)
+	}
+	if swapped == 0 {
+		logruslogger.Log(logruslogger.WarnLevel, sessionID, ctx, "refresh_reuse", uc.ReqID)
+		uc.RevokeSession(customerxID, sessionID)
+		return res, errors.New(helper.RefreshTokenReused)
+	}
+
+	// The new pair keeps the scopes of the session, a refresh can not widen them
+	payload := map[string]interface{}{
+		"customerx_id": customerxID,
+		"session_id":   sessionID,
+		"scopes":       claim["scopes"],
+	}
+	if clientID, ok := claim["client_id"]; ok {
+		payload["client_id"] = clientID
+	}
+	session.LastSeenAt = time.Now().Format(time.RFC3339)
+	err = uc.generateToken(payload, session, newRefreshID, &res)
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "generateToken", uc.ReqID)
+		return res, err
+	}
+
+	return res, err
+}
+
+// RevokeSession terminate a session and its refresh token
+func (uc JwtUC) RevokeSession(customerxID, sessionID string) {
+	sessionUc := SessionUC{ContractUC: uc.ContractUC}
+	sessionUc.Delete(customerxID, sessionID)
+}
+
+// Logout deny the access token until it expires and revoke its session
+func (uc JwtUC) Logout(claim map[string]interface{}) (err error) {
+	ctx := "JwtUC.Logout"
+
+	customerxID, _ := claim["customerx_id"].(string)
+	sessionID, _ := claim["session_id"].(string)
+	tokenID, _ := claim["token_id"].(string)
+	if tokenID != "" {
+		err = uc.StoreToRedisExp("tokenDenylist"+tokenID, true, uc.EnvConfig["TOKEN_EXP_SECRET"]+"h")
+		if err != nil {
+			logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "denylist", uc.ReqID)
+			return errors.New(helper.InternalServer)
+		}
+	}
+	uc.RevokeSession(customerxID, sessionID)
+
+	return err
+}
+
+// RevokeAll terminate every session of a customer, tokens of a terminated session are
+// rejected by the session check and can not be refreshed
+func (uc JwtUC) RevokeAll(customerxID string) (err error) {
+	ctx := "JwtUC.RevokeAll"
+
+	sessionUc := SessionUC{ContractUC: uc.ContractUC}
+	err = sessionUc.DeleteAll(customerxID)
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "DeleteAll", uc.ReqID)
+		return err
+	}
+
+	return err
+}
+
+// IsDenied check whether an access token id has been denied by a logout
+func (uc JwtUC) IsDenied(tokenID string) bool {
+	if tokenID == "" {
+		return false
+	}
+	count, err := uc.Redis.Exists("tokenDenylist" + tokenID).Result()
+
+	return err != nil || count > 0
+}
+
+func (uc JwtUC) generateToken(payload map[string]interface{}, session viewmodel.SessionVM, refreshID string, res *viewmodel.JwtVM) (err error) {
+	ctx := "JwtUC.generateToken"
+
+	// Every token pair gets a new device id so tokens issued before a refresh stop working
+	session.DeviceID = xid.New().String()
+	payload["device_id"] = session.DeviceID
+	payload["token_id"] = xid.New().String()
+	sessionUc := SessionUC{ContractUC: uc.ContractUC}
+	err = sessionUc.Save(payload["customerx_id"].(string), session)
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "session", uc.ReqID)
 		return errors.New(helper.InternalServer)
 	}
 	jwePayload, err := uc.ContractUC.Jwe.Generate(payload)
@@ -35,7 +190,18 @@ func (uc JwtUC) GenerateToken(payload map[string]interface{}, res *viewmodel.Jwt
 		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "jwt", uc.ReqID)
 		return errors.New(helper.JWT)
 	}
-	res.RefreshToken, res.RefreshExpiredDate, err = uc.ContractUC.Jwt.GetRefreshToken(jwePayload)
+
+	// The refresh token carries its own single use id on top of the session payload
+	refreshPayload := map[string]interface{}{"refresh_id": refreshID}
+	for k, v := range payload {
+		refreshPayload[k] = v
+	}
+	jweRefreshPayload, err := uc.ContractUC.Jwe.Generate(refreshPayload)
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "refresh_jwe", uc.ReqID)
+		return errors.New(helper.JWT)
+	}
+	res.RefreshToken, res.RefreshExpiredDate, err = uc.ContractUC.Jwt.GetRefreshToken(jweRefreshPayload)
 	if err != nil {
 		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "refresh_jwt", uc.ReqID)
 		return errors.New(helper.JWT)
@@ -0,0 +1,233 @@
+package usecase
+
+import (
+	"database/sql"
+	"errors"
+	"julo-backend/helper"
+	"julo-backend/model"
+	"julo-backend/pkg/logruslogger"
+	"julo-backend/usecase/viewmodel"
+)
+
+// LedgerUC ...
+type LedgerUC struct {
+	*ContractUC
+	Tx *sql.Tx
+}
+
+// Post store a journal entry and its lines, the entry must be balanced
+func (uc LedgerUC) Post(entry viewmodel.JournalEntryVM) (res viewmodel.JournalEntryVM, err error) {
+	const (
+		ctx = "LedgerUC.Post"
+	)
+
+	var debit, credit int
+	for _, line := range entry.Lines {
+		if line.Debit < 0 || line.Credit < 0 || (line.Debit == 0) == (line.Credit == 0) {
+			logruslogger.Log(logruslogger.WarnLevel, line.AccountID, ctx, "invalid_line", uc.ReqID)
+			return res, errors.New(helper.UnbalancedJournal)
+		}
+		debit += line.Debit
+		credit += line.Credit
+	}
+	if len(entry.Lines) < 2 || debit != credit {
+		logruslogger.Log(logruslogger.WarnLevel, "", ctx, "unbalanced", uc.ReqID)
+		return res, errors.New(helper.UnbalancedJournal)
+	}
+
+	res = entry
+	m := model.NewLedgerModel(uc.DB, uc.Tx)
+	res.ID, err = m.StoreEntry(entry)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "StoreEntry", uc.ReqID)
+		return res, err
+	}
+
+	for _, line := range entry.Lines {
+		_, err = m.StoreLine(res.ID, line)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "StoreLine", uc.ReqID)
+			return res, err
+		}
+		err = m.UpdateWalletBalance(line.AccountID, line.Credit-line.Debit)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "UpdateWalletBalance", uc.ReqID)
+			return res, err
+		}
+	}
+
+	return res, err
+}
+
+// SystemAccount find a system account, system accounts are seeded with the schema
+func (uc LedgerUC) SystemAccount(code string) (res viewmodel.LedgerAccountVM, err error) {
+	const (
+		ctx = "LedgerUC.SystemAccount"
+	)
+
+	m := model.NewLedgerModel(uc.DB, uc.Tx)
+	data, err := m.FindAccountByCode(code)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindAccountByCode", uc.ReqID)
+		return res, err
+	}
+	if data.ID == "" {
+		logruslogger.Log(logruslogger.ErrorLevel, code, ctx, "not_found", uc.ReqID)
+		return res, errors.New(helper.LedgerAccountNotFound)
+	}
+
+	res = viewmodel.LedgerAccountVM{
+		ID:   data.ID,
+		Code: data.Code,
+		Type: data.Type,
+	}
+
+	return res, err
+}
+
+// OpenWalletAccount open the ledger account of a new wallet, with the transaction creating the wallet
+func (uc LedgerUC) OpenWalletAccount(walletID string) (res viewmodel.LedgerAccountVM, err error) {
+	const (
+		ctx = "LedgerUC.OpenWalletAccount"
+	)
+
+	res = viewmodel.LedgerAccountVM{
+		Code:     helper.LedgerAccountWallet + walletID,
+		Type:     helper.LedgerAccountTypeWallet,
+		WalletID: walletID,
+	}
+	m := model.NewLedgerModel(uc.DB, uc.Tx)
+	res.ID, err = m.StoreAccount(res)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "StoreAccount", uc.ReqID)
+		return res, err
+	}
+
+	return res, err
+}
+
+// WalletAccount the ledger account of a wallet with its running balance
+func (uc LedgerUC) WalletAccount(walletID string) (res viewmodel.LedgerAccountVM, err error) {
+	const (
+		ctx = "LedgerUC.WalletAccount"
+	)
+
+	m := model.NewLedgerModel(uc.DB, uc.Tx)
+	data, err := m.FindAccountByCode(helper.LedgerAccountWallet + walletID)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindAccountByCode", uc.ReqID)
+		return res, err
+	}
+	if data.ID == "" {
+		logruslogger.Log(logruslogger.ErrorLevel, walletID, ctx, "not_found", uc.ReqID)
+		return res, errors.New(helper.LedgerAccountNotFound)
+	}
+
+	res = viewmodel.LedgerAccountVM{
+		ID:       data.ID,
+		Code:     data.Code,
+		Type:     data.Type,
+		WalletID: data.WalletID.String,
+		Balance:  data.Balance,
+	}
+
+	return res, err
+}
+
+// WalletBalance balance of a wallet derived from its ledger account
+func (uc LedgerUC) WalletBalance(walletID string) (res int, err error) {
+	const (
+		ctx = "LedgerUC.WalletBalance"
+	)
+
+	account, err := uc.WalletAccount(walletID)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "WalletAccount", uc.ReqID)
+		return res, err
+	}
+
+	return account.Balance, err
+}
+
+// PostBalance post the journal of a deposit or withdrawal, a deposit debits the
+// system deposit account and credits the wallet, a withdrawal debits the wallet
+// and credits the system withdrawal account
+func (uc LedgerUC) PostBalance(walletID string, req viewmodel.SendQueue) (res viewmodel.JournalEntryVM, err error) {
+	const (
+		ctx = "LedgerUC.PostBalance"
+	)
+
+	walletAccount, err := uc.WalletAccount(walletID)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "WalletAccount", uc.ReqID)
+		return res, err
+	}
+
+	res = viewmodel.JournalEntryVM{
+		BalanceID: req.BalanceID,
+		Type:      req.Type,
+	}
+	switch req.Type {
+	case helper.TypeDeposit:
+		systemAccount, err := uc.SystemAccount(helper.LedgerAccountDeposit)
+		if err != nil {
+			return res, err
+		}
+		res.Lines = []viewmodel.JournalLineVM{
+			{AccountID: systemAccount.ID, Debit: req.Amount},
+			{AccountID: walletAccount.ID, Credit: req.Amount},
+		}
+	case helper.TypeWithdrawal:
+		systemAccount, err := uc.SystemAccount(helper.LedgerAccountWithdrawal)
+		if err != nil {
+			return res, err
+		}
+		res.Lines = []viewmodel.JournalLineVM{
+			{AccountID: walletAccount.ID, Debit: req.Amount},
+			{AccountID: systemAccount.ID, Credit: req.Amount},
+		}
+	default:
+		return res, errors.New(helper.InvalidType)
+	}
+
+	res, err = uc.Post(res)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Post", uc.ReqID)
+		return res, err
+	}
+
+	return res, err
+}
+
+// PostTransfer post the journal of a transfer, debiting the sender wallet and crediting the receiver wallet
+func (uc LedgerUC) PostTransfer(fromWalletID, toWalletID string, req viewmodel.TransferResp) (res viewmodel.JournalEntryVM, err error) {
+	const (
+		ctx = "LedgerUC.PostTransfer"
+	)
+
+	fromAccount, err := uc.WalletAccount(fromWalletID)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "from_account", uc.ReqID)
+		return res, err
+	}
+	toAccount, err := uc.WalletAccount(toWalletID)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "to_account", uc.ReqID)
+		return res, err
+	}
+
+	res, err = uc.Post(viewmodel.JournalEntryVM{
+		TransferID: req.ID,
+		Type:       helper.TypeTransfer,
+		Lines: []viewmodel.JournalLineVM{
+			{AccountID: fromAccount.ID, Debit: req.Amount},
+			{AccountID: toAccount.ID, Credit: req.Amount},
+		},
+	})
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Post", uc.ReqID)
+		return res, err
+	}
+
+	return res, err
+}
@@ -0,0 +1,84 @@
+package usecase
+
+import (
+	"julo-backend/model"
+	"julo-backend/pkg/amqp"
+	"julo-backend/pkg/interfacepkg"
+	"julo-backend/pkg/logruslogger"
+	"strconv"
+	"time"
+)
+
+// OutboxUC ...
+type OutboxUC struct {
+	*ContractUC
+	// Queue confirmed channel the messages are published on
+	Queue *amqp.ConfirmQueue
+}
+
+// Relay keep publishing pending outbox messages, it waits for the interval when the outbox is empty
+// or the broker can not be reached
+func (uc OutboxUC) Relay(interval time.Duration) {
+	const (
+		ctx = "OutboxUC.Relay"
+	)
+
+	for {
+		count, err := uc.Publish(OutboxBatchSize)
+		if err != nil {
+			logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "Publish", uc.ReqID)
+		}
+		if err != nil || count < OutboxBatchSize {
+			time.Sleep(interval)
+		}
+	}
+}
+
+// Publish claim a batch of pending outbox messages, publish them and mark each sent once the broker
+// confirmed it. No transaction is open while publishing, a message may be published twice when the
+// relay stops between the confirm and the mark so consumers must be idempotent.
+func (uc OutboxUC) Publish(limit int) (count int, err error) {
+	const (
+		ctx = "OutboxUC.Publish"
+	)
+
+	m := model.NewOutboxModel(uc.DB, nil)
+	data, err := m.Claim(limit, OutboxClaimSeconds)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Claim", uc.ReqID)
+		return count, err
+	}
+
+	for i, d := range data {
+		publishErr := uc.Queue.PushQueueReconnect(interfacepkg.UnmarshallMap(d.Payload), d.Queue, d.DeadLetterQueue)
+		if publishErr != nil {
+			// The broker is most likely down, give the rest of the batch back for the next run
+			logruslogger.Log(logruslogger.WarnLevel, d.ID+" attempt "+strconv.Itoa(d.Attempts+1)+": "+publishErr.Error(), ctx, "PushQueueReconnect", uc.ReqID)
+			err = m.MarkFailed(d.ID, publishErr.Error())
+			if err != nil {
+				logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "MarkFailed", uc.ReqID)
+			}
+			var rest []string
+			for _, r := range data[i+1:] {
+				rest = append(rest, r.ID)
+			}
+			if len(rest) > 0 {
+				err = m.Release(rest)
+				if err != nil {
+					logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Release", uc.ReqID)
+				}
+			}
+
+			return count, publishErr
+		}
+
+		err = m.MarkSent(d.ID)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "MarkSent", uc.ReqID)
+			return count, err
+		}
+		count++
+	}
+
+	return count, err
+}
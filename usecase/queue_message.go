@@ -0,0 +1,80 @@
+package usecase
+
+import (
+	"encoding/json"
+	"errors"
+	"julo-backend/helper"
+	"julo-backend/usecase/viewmodel"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+var (
+	// QueueSchemaVersion version of the queue envelope written by this service, version 2 identifies
+	// the wallet owner by its blind index
+	QueueSchemaVersion = 2
+	// QueueTypeUpdateBalance ...
+	QueueTypeUpdateBalance = "update_balance"
+)
+
+// NewUpdateBalanceMessage wrap an update balance payload into a versioned envelope
+func NewUpdateBalanceMessage(correlationID string, payload viewmodel.SendQueue) viewmodel.QueueEnvelope {
+	return viewmodel.QueueEnvelope{
+		SchemaVersion: QueueSchemaVersion,
+		MessageID:     xid.New().String(),
+		Type:          QueueTypeUpdateBalance,
+		CorrelationID: correlationID,
+		Timestamp:     time.Now().Format(time.RFC3339),
+		Payload:       payload,
+	}
+}
+
+// DecodeUpdateBalanceMessage decode and validate an update balance message, the flat
+// messages published before the envelope existed are still accepted
+func DecodeUpdateBalanceMessage(body []byte) (res viewmodel.QueueEnvelope, err error) {
+	err = json.Unmarshal(body, &res)
+	if err != nil {
+		return res, errors.New(helper.InvalidMessage + ": " + err.Error())
+	}
+
+	if res.SchemaVersion == 0 {
+		var legacy struct {
+			viewmodel.SendQueue
+			Qid string `json:"qid"`
+		}
+		err = json.Unmarshal(body, &legacy)
+		if err != nil {
+			return res, errors.New(helper.InvalidMessage + ": " + err.Error())
+		}
+		res = viewmodel.QueueEnvelope{
+			Type:          QueueTypeUpdateBalance,
+			CorrelationID: legacy.Qid,
+			Payload:       legacy.SendQueue,
+		}
+	} else if res.SchemaVersion > QueueSchemaVersion {
+		return res, errors.New(helper.InvalidMessage + ": unsupported schema version")
+	}
+
+	if res.Type != QueueTypeUpdateBalance {
+		return res, errors.New(helper.InvalidMessage + ": unexpected type " + res.Type)
+	}
+	if res.Payload.BalanceID == "" || res.Payload.OwnedByIndex == "" && res.Payload.OwnedBy == "" || res.Payload.Amount <= 0 {
+		return res, errors.New(helper.InvalidMessage + ": incomplete payload")
+	}
+	if res.Payload.Type != helper.TypeDeposit && res.Payload.Type != helper.TypeWithdrawal {
+		return res, errors.New(helper.InvalidMessage + ": unexpected balance type " + res.Payload.Type)
+	}
+
+	return res, err
+}
+
+// OwnerIndex blind index of the wallet owner of a message, the messages published before schema
+// version 2 carry the customer id instead
+func (uc ContractUC) OwnerIndex(req viewmodel.SendQueue) string {
+	if req.OwnedByIndex != "" {
+		return req.OwnedByIndex
+	}
+
+	return uc.CustomerIndex(req.OwnedBy)
+}
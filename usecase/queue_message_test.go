@@ -0,0 +1,116 @@
+package usecase
+
+import (
+	"julo-backend/helper"
+	"julo-backend/usecase/viewmodel"
+	"strings"
+	"testing"
+)
+
+func TestDecodeUpdateBalanceMessage(t *testing.T) {
+	const (
+		balanceID    = "c4d1a3e0-8a3b-4d5e-9f6a-1b2c3d4e5f60"
+		ownedBy      = "ea0212d3-abd6-406f-8c67-868e814a2436"
+		ownedByIndex = "9ffac7a4e734b337659d79089b51959f62e59ec4a6650882c20ec5f26c16663c"
+	)
+
+	tests := []struct {
+		name string
+		body string
+		want viewmodel.QueueEnvelope
+		err  string
+	}{
+		{
+			name: "legacy flat message",
+			body: `{"qid":"q1","balance_id":"` + balanceID + `","amount":10000,"owned_by":"` + ownedBy + `","type":"deposit"}`,
+			want: viewmodel.QueueEnvelope{
+				Type:          QueueTypeUpdateBalance,
+				CorrelationID: "q1",
+				Payload:       viewmodel.SendQueue{BalanceID: balanceID, Amount: 10000, OwnedBy: ownedBy, Type: helper.TypeDeposit},
+			},
+		},
+		{
+			name: "v1 envelope",
+			body: `{"schema_version":1,"message_id":"m1","type":"update_balance","correlation_id":"q1","timestamp":"2026-01-01T00:00:00Z",
+				"payload":{"balance_id":"` + balanceID + `","amount":10000,"owned_by":"` + ownedBy + `","type":"withdrawal"}}`,
+			want: viewmodel.QueueEnvelope{
+				SchemaVersion: 1,
+				MessageID:     "m1",
+				Type:          QueueTypeUpdateBalance,
+				CorrelationID: "q1",
+				Timestamp:     "2026-01-01T00:00:00Z",
+				Payload:       viewmodel.SendQueue{BalanceID: balanceID, Amount: 10000, OwnedBy: ownedBy, Type: helper.TypeWithdrawal},
+			},
+		},
+		{
+			name: "v2 envelope",
+			body: `{"schema_version":2,"message_id":"m1","type":"update_balance","correlation_id":"q1","timestamp":"2026-01-01T00:00:00Z",
+				"payload":{"balance_id":"` + balanceID + `","amount":10000,"owned_by_index":"` + ownedByIndex + `","type":"deposit"}}`,
+			want: viewmodel.QueueEnvelope{
+				SchemaVersion: 2,
+				MessageID:     "m1",
+				Type:          QueueTypeUpdateBalance,
+				CorrelationID: "q1",
+				Timestamp:     "2026-01-01T00:00:00Z",
+				Payload:       viewmodel.SendQueue{BalanceID: balanceID, Amount: 10000, OwnedByIndex: ownedByIndex, Type: helper.TypeDeposit},
+			},
+		},
+		{
+			name: "not json",
+			body: `balance_id=` + balanceID,
+			err:  "invalid character",
+		},
+		{
+			name: "wrong field type",
+			body: `{"schema_version":2,"type":"update_balance","payload":{"balance_id":"` + balanceID + `","amount":"10000"}}`,
+			err:  "cannot unmarshal",
+		},
+		{
+			name: "unsupported schema version",
+			body: `{"schema_version":3,"type":"update_balance","payload":{"balance_id":"` + balanceID + `","amount":10000,"owned_by_index":"` + ownedByIndex + `","type":"deposit"}}`,
+			err:  "unsupported schema version",
+		},
+		{
+			name: "unexpected type",
+			body: `{"schema_version":2,"type":"close_wallet","payload":{"balance_id":"` + balanceID + `","amount":10000,"owned_by_index":"` + ownedByIndex + `","type":"deposit"}}`,
+			err:  "unexpected type close_wallet",
+		},
+		{
+			name: "missing owner",
+			body: `{"schema_version":2,"type":"update_balance","payload":{"balance_id":"` + balanceID + `","amount":10000,"type":"deposit"}}`,
+			err:  "incomplete payload",
+		},
+		{
+			name: "missing balance id",
+			body: `{"qid":"q1","amount":10000,"owned_by":"` + ownedBy + `","type":"deposit"}`,
+			err:  "incomplete payload",
+		},
+		{
+			name: "zero amount",
+			body: `{"schema_version":2,"type":"update_balance","payload":{"balance_id":"` + balanceID + `","amount":0,"owned_by_index":"` + ownedByIndex + `","type":"deposit"}}`,
+			err:  "incomplete payload",
+		},
+		{
+			name: "unexpected balance type",
+			body: `{"schema_version":2,"type":"update_balance","payload":{"balance_id":"` + balanceID + `","amount":10000,"owned_by_index":"` + ownedByIndex + `","type":"transfer"}}`,
+			err:  "unexpected balance type transfer",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := DecodeUpdateBalanceMessage([]byte(tt.body))
+			if tt.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), helper.InvalidMessage) || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error %v, want %s: %s", err, helper.InvalidMessage, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res != tt.want {
+				t.Errorf("message %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package usecase
+
+import (
+	"encoding/json"
+	"errors"
+	"julo-backend/helper"
+	"julo-backend/pkg/logruslogger"
+	"julo-backend/usecase/viewmodel"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// SessionUC registry of the sessions of a customer, each session is stored under its own key which expires
+// with its refresh token and the userSessions hash of the customer indexes their ids
+type SessionUC struct {
+	*ContractUC
+}
+
+// Save store the session for the lifetime of its refresh token
+func (uc SessionUC) Save(customerxID string, session viewmodel.SessionVM) (err error) {
+	ctx := "SessionUC.Save"
+
+	// The stored session keeps the device id which is hidden from the json response
+	b, err := json.Marshal(sessionRecord{SessionVM: session, DeviceID: session.DeviceID})
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "json_marshal", uc.ReqID)
+		return err
+	}
+
+	dur := uc.sessionTTL()
+	ownedByIndex := uc.CustomerIndex(customerxID)
+	index := sessionIndexKey(ownedByIndex)
+	_, err = uc.Redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(sessionKey(ownedByIndex, session.SessionID), string(b), dur)
+		pipe.HSet(index, session.SessionID, time.Now().Add(dur).Format(time.RFC3339))
+		// The session saved last expires last, the index lives as long
+		pipe.Expire(index, dur)
+		return nil
+	})
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "redis_set", uc.ReqID)
+		return err
+	}
+
+	return err
+}
+
+// Find ...
+func (uc SessionUC) Find(customerxID, sessionID string) (res viewmodel.SessionVM, err error) {
+	ctx := "SessionUC.Find"
+
+	ownedByIndex := uc.CustomerIndex(customerxID)
+	val, err := uc.Redis.Get(sessionKey(ownedByIndex, sessionID)).Result()
+	if err == redis.Nil {
+		// Sessions saved before each session had its own key are stored in the index
+		val, err = uc.Redis.HGet(sessionIndexKey(ownedByIndex), sessionID).Result()
+		if err == nil {
+			res, err = uc.legacySession(val)
+			if err == nil {
+				return res, err
+			}
+		}
+	}
+	if err != nil {
+		logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "redis_get", uc.ReqID)
+		return res, errors.New(helper.ExpiredSession)
+	}
+
+	return decodeSession(val)
+}
+
+// FindAll list the sessions of a customer, the most recently seen first. The expired sessions are removed
+// from the index.
+func (uc SessionUC) FindAll(customerxID string) (res []viewmodel.SessionVM, err error) {
+	ctx := "SessionUC.FindAll"
+
+	ownedByIndex := uc.CustomerIndex(customerxID)
+	index := sessionIndexKey(ownedByIndex)
+	vals, err := uc.Redis.HGetAll(index).Result()
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "redis_hgetall", uc.ReqID)
+		return res, err
+	}
+
+	res = []viewmodel.SessionVM{}
+	if len(vals) == 0 {
+		return res, nil
+	}
+	sessionIDs := []string{}
+	keys := []string{}
+	for sessionID := range vals {
+		sessionIDs = append(sessionIDs, sessionID)
+		keys = append(keys, sessionKey(ownedByIndex, sessionID))
+	}
+	sessions, err := uc.Redis.MGet(keys...).Result()
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "redis_mget", uc.ReqID)
+		return res, err
+	}
+
+	expired := []string{}
+	for i, sessionID := range sessionIDs {
+		var session viewmodel.SessionVM
+		if val, ok := sessions[i].(string); ok {
+			session, err = decodeSession(val)
+		} else {
+			session, err = uc.legacySession(vals[sessionID])
+		}
+		if err != nil {
+			expired = append(expired, sessionID)
+			continue
+		}
+		res = append(res, session)
+	}
+	if len(expired) > 0 {
+		uc.Redis.HDel(index, expired...)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].LastSeenAt > res[j].LastSeenAt
+	})
+
+	return res, nil
+}
+
+// touchScript set the session only while it exists and keep its expiry, a session revoked by a concurrent
+// request stays revoked
+var touchScript = redis.NewScript(`
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl > 0 then
+	return redis.call("SET", KEYS[1], ARGV[1], "PX", ttl)
+end
+return -1`)
+
+// Touch update the last seen time of a session
+func (uc SessionUC) Touch(customerxID string, session viewmodel.SessionVM) {
+	ctx := "SessionUC.Touch"
+
+	session.LastSeenAt = time.Now().Format(time.RFC3339)
+	b, err := json.Marshal(sessionRecord{SessionVM: session, DeviceID: session.DeviceID})
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "json_marshal", uc.ReqID)
+		return
+	}
+
+	err = touchScript.Run(uc.Redis, []string{sessionKey(uc.CustomerIndex(customerxID), session.SessionID)}, string(b)).Err()
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "redis_touch", uc.ReqID)
+	}
+}
+
+// Delete terminate a session and its refresh token
+func (uc SessionUC) Delete(customerxID, sessionID string) (err error) {
+	ctx := "SessionUC.Delete"
+
+	ownedByIndex := uc.CustomerIndex(customerxID)
+	count, err := uc.Redis.HDel(sessionIndexKey(ownedByIndex), sessionID).Result()
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "redis_hdel", uc.ReqID)
+		return errors.New(helper.InternalServer)
+	}
+	err = uc.Redis.Del(sessionKey(ownedByIndex, sessionID), "refreshID"+sessionID).Err()
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "redis_del", uc.ReqID)
+		return errors.New(helper.InternalServer)
+	}
+	if count == 0 {
+		return errors.New(helper.SessionNotFound)
+	}
+
+	return nil
+}
+
+// DeleteAll terminate every session of a customer
+func (uc SessionUC) DeleteAll(customerxID string) (err error) {
+	return uc.DeleteAllByIndex(uc.CustomerIndex(customerxID))
+}
+
+// DeleteAllByIndex terminate every session of the customer of the blind index
+func (uc SessionUC) DeleteAllByIndex(ownedByIndex string) (err error) {
+	ctx := "SessionUC.DeleteAllByIndex"
+
+	index := sessionIndexKey(ownedByIndex)
+	sessionIDs, err := uc.Redis.HKeys(index).Result()
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "redis_hkeys", uc.ReqID)
+		return errors.New(helper.InternalServer)
+	}
+
+	keys := []string{index}
+	for _, sessionID := range sessionIDs {
+		keys = append(keys, sessionKey(ownedByIndex, sessionID), "refreshID"+sessionID)
+	}
+	err = uc.Redis.Del(keys...).Err()
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "redis_del", uc.ReqID)
+		return errors.New(helper.InternalServer)
+	}
+
+	return err
+}
+
+// legacySession a session stored in the index itself before each session had its own key, it expires
+// a refresh token lifetime after it was last seen
+func (uc SessionUC) legacySession(val string) (res viewmodel.SessionVM, err error) {
+	res, err = decodeSession(val)
+	if err != nil {
+		return res, err
+	}
+	lastSeen, err := time.Parse(time.RFC3339, res.LastSeenAt)
+	if err != nil || time.Since(lastSeen) > uc.sessionTTL() {
+		return res, errors.New(helper.ExpiredSession)
+	}
+
+	return res, nil
+}
+
+// sessionTTL a session lives as long as its refresh token
+func (uc SessionUC) sessionTTL() time.Duration {
+	dur, _ := time.ParseDuration(uc.EnvConfig["TOKEN_EXP_REFRESH_SECRET"] + "h")
+
+	return dur
+}
+
+// sessionIndexKey the sessions are keyed by the blind index of the customer so every spelling of the id finds them
+func sessionIndexKey(ownedByIndex string) string {
+	return "userSessions" + ownedByIndex
+}
+
+// sessionKey ...
+func sessionKey(ownedByIndex, sessionID string) string {
+	return "userSession" + ownedByIndex + ":" + sessionID
+}
+
+// sessionRecord ...
+type sessionRecord struct {
+	viewmodel.SessionVM
+	DeviceID string `json:"device_id"`
+}
+
+func decodeSession(val string) (res viewmodel.SessionVM, err error) {
+	record := sessionRecord{}
+	err = json.Unmarshal([]byte(val), &record)
+	if err != nil {
+		return res, err
+	}
+	res = record.SessionVM
+	res.DeviceID = record.DeviceID
+
+	return res, err
+}
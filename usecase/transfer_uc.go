@@ -0,0 +1,177 @@
+package usecase
+
+import (
+	"database/sql"
+	"errors"
+	"julo-backend/helper"
+	"julo-backend/model"
+	"julo-backend/pkg/logruslogger"
+	"julo-backend/server/request"
+	"julo-backend/usecase/viewmodel"
+	"time"
+)
+
+// TransferUC ...
+type TransferUC struct {
+	*ContractUC
+	Tx    *sql.Tx
+	Audit viewmodel.AuditContextVM
+}
+
+// Transfer move money from the caller wallet to another wallet in a single transaction
+func (uc TransferUC) Transfer(req *request.TransferRequest) (res viewmodel.TransferVM, err error) {
+	const (
+		ctx = "TransferUC.Transfer"
+	)
+
+	// Customer ids are case insensitive, compare them the way wallets are looked up
+	if uc.CustomerIndex(req.ToCustomerxID) == uc.CustomerIndex(req.CustomerxID) {
+		return res, errors.New(helper.TransferToSelf)
+	}
+
+	m := model.NewTransferModel(uc.DB, uc.Tx)
+	ok, err := m.ReferenceExist(req.ReferenceID)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "ReferenceExist", uc.ReqID)
+		return res, err
+	}
+
+	if ok {
+		logruslogger.Log(logruslogger.InfoLevel, "", ctx, "ReferenceExist", uc.ReqID)
+		return res, errors.New(helper.ReferenceExist)
+	}
+
+	tx := model.SQLDBTx{DB: uc.DB}
+	txFunc, err := tx.TxBegin()
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "TxBegin", uc.ReqID)
+		return res, err
+	}
+
+	err = txFunc.TxEnd(func() error {
+		res, err = uc.transfer(txFunc.DB, req)
+		return err
+	})
+	if err != nil {
+		logruslogger.Log(logruslogger.WarnLevel, err.Error(), ctx, "transfer", uc.ReqID)
+		return res, err
+	}
+
+	return res, err
+}
+
+func (uc TransferUC) transfer(tx *sql.Tx, req *request.TransferRequest) (res viewmodel.TransferVM, err error) {
+	const (
+		ctx = "TransferUC.transfer"
+	)
+
+	// Lock both wallets in a stable order so opposite transfers can not deadlock
+	walletModel := model.NewWalletModel(uc.DB, tx)
+	owners := []string{uc.CustomerIndex(req.CustomerxID), uc.CustomerIndex(req.ToCustomerxID)}
+	if owners[1] < owners[0] {
+		owners[0], owners[1] = owners[1], owners[0]
+	}
+	wallets := map[string]model.WalletEntity{}
+	for _, owner := range owners {
+		wallets[owner], err = walletModel.FindByOwenForUpdate(owner)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindByOwenForUpdate", uc.ReqID)
+			return res, err
+		}
+	}
+
+	from := wallets[uc.CustomerIndex(req.CustomerxID)]
+	err = walletAccepts(from, helper.TypeWithdrawal)
+	if err != nil {
+		return res, err
+	}
+	to := wallets[uc.CustomerIndex(req.ToCustomerxID)]
+	if to.ID == "" {
+		return res, errors.New(helper.ReceiverNotFound)
+	}
+	err = walletAccepts(to, helper.TypeDeposit)
+	if err != nil {
+		if err.Error() == helper.Frozen {
+			return res, errors.New(helper.ReceiverFrozen)
+		}
+		return res, errors.New(helper.ReceiverDisabled)
+	}
+
+	ledgerUc := LedgerUC{ContractUC: uc.ContractUC, Tx: tx}
+	balance, err := ledgerUc.WalletBalance(from.ID)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "WalletBalance", uc.ReqID)
+		return res, err
+	}
+	if req.Amount > balance {
+		return res, errors.New(helper.InsufficientBalance)
+	}
+
+	res.Transfer = viewmodel.TransferResp{
+		Amount:        req.Amount,
+		Status:        helper.StatusSuccess,
+		ReferenceID:   req.ReferenceID,
+		TransferredBy: req.CustomerxID,
+		ReceivedBy:    req.ToCustomerxID,
+		TransferredAt: time.Now().Format(time.RFC3339),
+	}
+	stored := res.Transfer
+	var transferredByIndex, receivedByIndex string
+	stored.TransferredBy, transferredByIndex, err = uc.EncryptCustomer(model.TransferTransferredBy, req.CustomerxID)
+	if err == nil {
+		stored.ReceivedBy, receivedByIndex, err = uc.EncryptCustomer(model.TransferReceivedBy, req.ToCustomerxID)
+	}
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "EncryptCustomer", uc.ReqID)
+		return res, err
+	}
+	m := model.NewTransferModel(uc.DB, tx)
+	res.Transfer.ID, err = m.Store(stored, transferredByIndex, receivedByIndex)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Store", uc.ReqID)
+		return res, err
+	}
+
+	_, err = ledgerUc.PostTransfer(from.ID, to.ID, res.Transfer)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "PostTransfer", uc.ReqID)
+		return res, err
+	}
+
+	updated := map[string]model.WalletEntity{}
+	for _, wallet := range []model.WalletEntity{from, to} {
+		balance, err = ledgerUc.WalletBalance(wallet.ID)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "WalletBalance", uc.ReqID)
+			return res, err
+		}
+		_, err = walletModel.UpdateBalance(wallet.OwnedByIndex, balance)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "UpdateBalance", uc.ReqID)
+			return res, err
+		}
+		wallet.Balance = balance
+		updated[wallet.ID] = wallet
+	}
+
+	// Each wallet has its own audit chain, it is already serialized by the wallet row lock
+	auditUc := AuditUC{ContractUC: uc.ContractUC, Tx: tx}
+	actions := map[string]string{from.ID: helper.AuditTransferOut, to.ID: helper.AuditTransferIn}
+	for _, wallet := range []model.WalletEntity{from, to} {
+		after := walletSnapshot(updated[wallet.ID])
+		after.Operation = &viewmodel.OperationSnapshotVM{
+			ID:          res.Transfer.ID,
+			Type:        helper.TypeTransfer,
+			Amount:      req.Amount,
+			ReferenceID: req.ReferenceID,
+			Status:      helper.StatusSuccess,
+		}
+		err = auditUc.Record(uc.Audit, actions[wallet.ID], wallet.ID, walletSnapshot(wallet), after)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Record", uc.ReqID)
+			return res, err
+		}
+	}
+
+	return res, err
+}
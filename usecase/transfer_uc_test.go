@@ -0,0 +1,61 @@
+package usecase
+
+import (
+	"julo-backend/helper"
+	"julo-backend/pkg/aes"
+	"julo-backend/server/request"
+	"strings"
+	"testing"
+)
+
+func TestTransferToSelf(t *testing.T) {
+	uc := &ContractUC{EnvConfig: map[string]string{}, Aes: aes.Credential{Key: "goinitsecret32bitsupersecret"}}
+	req := request.TransferRequest{
+		CustomerxID:   "ea0212d3-abd6-406f-8c67-868e814a2436",
+		ToCustomerxID: "EA0212D3-ABD6-406F-8C67-868E814A2436",
+		Amount:        10000,
+	}
+
+	_, err := TransferUC{ContractUC: uc}.Transfer(&req)
+	if err == nil || err.Error() != helper.TransferToSelf {
+		t.Errorf("error %v, want %s", err, helper.TransferToSelf)
+	}
+}
+
+func TestTransferHistory(t *testing.T) {
+	const amount = 20000
+
+	uc := testContractUC(t)
+	defer uc.DB.Close()
+	from, _ := testWallet(t, uc)
+	to, _ := testWallet(t, uc)
+	if err := testDeliver(uc, testBalance(t, uc, from, helper.TypeDeposit, amount)); err != nil {
+		t.Fatal(err)
+	}
+
+	var referenceID string
+	if err := uc.DB.QueryRow(`SELECT uuid_generate_v4()::text`).Scan(&referenceID); err != nil {
+		t.Fatal(err)
+	}
+	res, err := TransferUC{ContractUC: uc}.Transfer(&request.TransferRequest{
+		CustomerxID: from, ToCustomerxID: strings.ToUpper(to), Amount: amount, ReferenceID: referenceID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both customers see the transfer, the receiver too when filtering on the type
+	for _, req := range []request.TransactionRequest{{CustomerxID: from}, {CustomerxID: to, Type: helper.TypeTransfer}} {
+		list, err := BalanceUC{ContractUC: uc}.FindTransactions(&req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Transactions) == 0 || list.Transactions[0].ID != res.Transfer.ID {
+			t.Fatalf("history of %s is missing transfer %s: %+v", req.CustomerxID, res.Transfer.ID, list.Transactions)
+		}
+		transfer := list.Transactions[0]
+		if transfer.Type != helper.TypeTransfer || transfer.Amount != amount || transfer.TransactedBy != from || transfer.ReceivedBy != to {
+			t.Errorf("transfer %+v", transfer)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package viewmodel
+
+// AdminWalletVM ...
+type AdminWalletVM struct {
+	ID              string `json:"id"`
+	OwnedBy         string `json:"owned_by"`
+	Status          string `json:"status"`
+	Balance         int    `json:"balance"`
+	EnabledAt       string `json:"enabled_at"`
+	DisabledAt      string `json:"disabled_at"`
+	CreatedByClient string `json:"created_by_client"`
+	FrozenReason    string `json:"frozen_reason,omitempty"`
+	FrozenUntil     string `json:"frozen_until,omitempty"`
+	AcceptDeposits  bool   `json:"accept_deposits,omitempty"`
+	ClosedAt        string `json:"closed_at,omitempty"`
+	ClosedReason    string `json:"closed_reason,omitempty"`
+	RetainUntil     string `json:"retain_until,omitempty"`
+	// ClosingPayoutID the pending payout the wallet is closed with once processed
+	ClosingPayoutID string `json:"closing_payout_id,omitempty"`
+}
+
+// AdminWalletListVM ...
+type AdminWalletListVM struct {
+	Wallets    []AdminWalletVM `json:"wallets"`
+	NextCursor string          `json:"next_cursor"`
+}
+
+// AdminWalletDetailVM ...
+type AdminWalletDetailVM struct {
+	Wallet       AdminWalletVM   `json:"wallet"`
+	Transactions []TransactionVM `json:"transactions"`
+}
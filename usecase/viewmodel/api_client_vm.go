@@ -0,0 +1,18 @@
+package viewmodel
+
+// ApiClientVM ...
+type ApiClientVM struct {
+	ID         string   `json:"id"`
+	ClientID   string   `json:"client_id"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	Enabled    bool     `json:"enabled"`
+	CreatedAt  string   `json:"created_at"`
+	DisabledAt string   `json:"disabled_at"`
+}
+
+// ApiClientCredentialVM the secret is only shown when it is issued
+type ApiClientCredentialVM struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
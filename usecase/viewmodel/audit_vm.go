@@ -0,0 +1,68 @@
+package viewmodel
+
+import "encoding/json"
+
+// AuditContextVM who is acting and on which request, recorded with every change it makes
+type AuditContextVM struct {
+	Actor     string `json:"actor"`
+	RequestID string `json:"request_id"`
+	IP        string `json:"ip"`
+	Reason    string `json:"reason"`
+}
+
+// WalletSnapshotVM the state of a wallet recorded before and after a change, the owner is left out
+type WalletSnapshotVM struct {
+	ID         string `json:"id"`
+	Status     string `json:"status"`
+	Balance    int    `json:"balance"`
+	EnabledAt  string `json:"enabled_at,omitempty"`
+	DisabledAt string `json:"disabled_at,omitempty"`
+	// FrozenReason, FrozenUntil and AcceptDeposits describe the freeze of a frozen wallet
+	FrozenReason   string `json:"frozen_reason,omitempty"`
+	FrozenUntil    string `json:"frozen_until,omitempty"`
+	AcceptDeposits bool   `json:"accept_deposits,omitempty"`
+	ClosedAt       string `json:"closed_at,omitempty"`
+	// ClosingPayoutID the pending payout of a closing wallet
+	ClosingPayoutID string `json:"closing_payout_id,omitempty"`
+	// Operation the balance operation or transfer applied to the wallet
+	Operation *OperationSnapshotVM `json:"operation,omitempty"`
+}
+
+// OperationSnapshotVM ...
+type OperationSnapshotVM struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Amount      int    `json:"amount"`
+	ReferenceID string `json:"reference_id,omitempty"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// AuditEventVM ...
+type AuditEventVM struct {
+	Seq       int64           `json:"seq"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	WalletID  string          `json:"wallet_id"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	Reason    string          `json:"reason"`
+	RequestID string          `json:"request_id"`
+	IP        string          `json:"ip"`
+	CreatedAt string          `json:"created_at"`
+	Hash      string          `json:"hash"`
+}
+
+// AuditEventListVM ...
+type AuditEventListVM struct {
+	Events     []AuditEventVM `json:"events"`
+	NextCursor string         `json:"next_cursor"`
+}
+
+// AuditVerifyVM ...
+type AuditVerifyVM struct {
+	Count    int   `json:"count"`
+	Chains   int   `json:"chains"`
+	LastSeq  int64 `json:"last_seq"`
+	BrokenAt int64 `json:"broken_at"`
+}
@@ -17,12 +17,15 @@ type WithdrawalVM struct {
 }
 
 type WithdrawalResp struct {
-	ID          string `json:"id"`
-	WithdrawnBy string `json:"withdrawn_by"`
-	Status      string `json:"status"`
-	WithdrawnAt string `json:"withdrawn_at"`
-	Amount      int    `json:"amaout"`
-	ReferenceID string `json:"reference_id"`
+	ID            string `json:"id"`
+	WithdrawnBy   string `json:"withdrawn_by"`
+	Status        string `json:"status"`
+	WithdrawnAt   string `json:"withdrawn_at"`
+	Amount        int    `json:"amaout"`
+	ReferenceID   string `json:"reference_id"`
+	FailureReason string `json:"failure_reason,omitempty"`
+	// Destination where the payout of a closed wallet was sent
+	Destination string `json:"destination,omitempty"`
 }
 
 type DepositVM struct {
@@ -30,17 +33,52 @@ type DepositVM struct {
 }
 
 type DepositResp struct {
-	ID          string `json:"id"`
-	DepositedBy string `json:"deposited_by"`
-	Status      string `json:"status"`
-	DepositedAt string `json:"deposited_at"`
-	Amount      int    `json:"amaout"`
-	ReferenceID string `json:"reference_id"`
+	ID            string `json:"id"`
+	DepositedBy   string `json:"deposited_by"`
+	Status        string `json:"status"`
+	DepositedAt   string `json:"deposited_at"`
+	Amount        int    `json:"amaout"`
+	ReferenceID   string `json:"reference_id"`
+	FailureReason string `json:"failure_reason,omitempty"`
 }
 
+// SendQueue payload of the update balance message
 type SendQueue struct {
 	BalanceID string `json:"balance_id"`
 	Amount    int    `json:"amount"`
-	OwnedBy   string `json:"owned_by"`
-	Type      string `json:"type"`
+	// OwnedByIndex blind index of the wallet owner, the customer id itself is not published
+	OwnedByIndex string `json:"owned_by_index,omitempty"`
+	// OwnedBy customer id of the messages published before schema version 2, only decoded
+	OwnedBy string `json:"owned_by,omitempty"`
+	Type    string `json:"type"`
+}
+
+// TransactionVM ...
+type TransactionVM struct {
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	Status       string `json:"status"`
+	Amount       int    `json:"amount"`
+	ReferenceID  string `json:"reference_id"`
+	TransactedBy string `json:"transacted_by"`
+	// ReceivedBy the receiver of a transfer, TransactedBy is its sender
+	ReceivedBy    string `json:"received_by,omitempty"`
+	TransactedAt  string `json:"transacted_at"`
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+// TransactionListVM ...
+type TransactionListVM struct {
+	Transactions []TransactionVM `json:"transactions"`
+	NextCursor   string          `json:"next_cursor"`
+}
+
+// QueueEnvelope versioned wrapper of every queue message shared by producers and consumers
+type QueueEnvelope struct {
+	SchemaVersion int       `json:"schema_version"`
+	MessageID     string    `json:"message_id"`
+	Type          string    `json:"type"`
+	CorrelationID string    `json:"correlation_id"`
+	Timestamp     string    `json:"timestamp"`
+	Payload       SendQueue `json:"payload"`
 }
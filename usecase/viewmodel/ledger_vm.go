@@ -0,0 +1,27 @@
+package viewmodel
+
+// LedgerAccountVM ...
+type LedgerAccountVM struct {
+	ID       string `json:"id"`
+	Code     string `json:"code"`
+	Type     string `json:"type"`
+	WalletID string `json:"wallet_id"`
+	Balance  int    `json:"balance"`
+}
+
+// JournalEntryVM ...
+type JournalEntryVM struct {
+	ID          string          `json:"id"`
+	BalanceID   string          `json:"balance_id"`
+	TransferID  string          `json:"transfer_id"`
+	Type        string          `json:"type"`
+	Description string          `json:"description"`
+	Lines       []JournalLineVM `json:"lines"`
+}
+
+// JournalLineVM ...
+type JournalLineVM struct {
+	AccountID string `json:"account_id"`
+	Debit     int    `json:"debit"`
+	Credit    int    `json:"credit"`
+}
@@ -0,0 +1,9 @@
+package viewmodel
+
+// OutboxVM ...
+type OutboxVM struct {
+	ID              string `json:"id"`
+	Queue           string `json:"queue"`
+	DeadLetterQueue string `json:"dead_letter_queue"`
+	Payload         string `json:"payload"`
+}
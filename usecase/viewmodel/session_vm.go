@@ -0,0 +1,17 @@
+package viewmodel
+
+// SessionVM ...
+type SessionVM struct {
+	SessionID  string `json:"session_id"`
+	DeviceID   string `json:"-"`
+	UserAgent  string `json:"user_agent"`
+	IP         string `json:"ip"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	Current    bool   `json:"current"`
+}
+
+// SessionListVM ...
+type SessionListVM struct {
+	Sessions []SessionVM `json:"sessions"`
+}
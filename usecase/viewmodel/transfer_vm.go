@@ -0,0 +1,17 @@
+package viewmodel
+
+// TransferVM ...
+type TransferVM struct {
+	Transfer TransferResp `json:"transfer"`
+}
+
+// TransferResp ...
+type TransferResp struct {
+	ID            string `json:"id"`
+	TransferredBy string `json:"transferred_by"`
+	ReceivedBy    string `json:"received_by"`
+	Status        string `json:"status"`
+	TransferredAt string `json:"transferred_at"`
+	Amount        int    `json:"amount"`
+	ReferenceID   string `json:"reference_id"`
+}
@@ -27,6 +27,21 @@ type WalletDisbleResp struct {
 	Balance    int    `json:"balance"`
 }
 
+// WalletCloseVM payout is the withdrawal of the remaining balance
+type WalletCloseVM struct {
+	WalletVM WalletCloseResp `json:"wallet"`
+	Payout   *WithdrawalResp `json:"payout,omitempty"`
+}
+
+// WalletCloseResp ...
+type WalletCloseResp struct {
+	ID       string `json:"id"`
+	OwnedBy  string `json:"owned_by"`
+	Status   string `json:"status"`
+	ClosedAt string `json:"closed_at"`
+	Balance  int    `json:"balance"`
+}
+
 // WalletVM...
 type WalletVM struct {
 	ID         string `json:"id"`
@@ -6,15 +6,20 @@ import (
 	"julo-backend/helper"
 	"julo-backend/model"
 	"julo-backend/pkg/logruslogger"
+	"julo-backend/pkg/str"
 	"julo-backend/server/request"
 	"julo-backend/usecase/viewmodel"
+	"strings"
 	"time"
 )
 
 // WalletUC ...
 type WalletUC struct {
 	*ContractUC
-	Tx *sql.Tx
+	Tx    *sql.Tx
+	Audit viewmodel.AuditContextVM
+	// Operator the status is changed by an operator, who can also freeze the wallet
+	Operator bool
 }
 
 func (uc WalletUC) Init(req *request.WalletInitRequest) (res viewmodel.JwtVM, err error) {
@@ -22,26 +27,42 @@ func (uc WalletUC) Init(req *request.WalletInitRequest) (res viewmodel.JwtVM, er
 		ctx = "WalletUC.Init"
 	)
 
-	m := model.NewWalletModel(uc.DB, uc.Tx)
-	ok, err := m.WalletExist(req.CustomerxID)
+	scopes, err := uc.tokenScopes(req.Scopes, req.ClientScopes)
+	if err != nil {
+		logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "tokenScopes", uc.ReqID)
+		return res, err
+	}
+
+	wallet, err := uc.findByOwen(req.CustomerxID)
 	if err != nil {
-		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "WalletExist", uc.ReqID)
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "findByOwen", uc.ReqID)
 		return res, err
 	}
 
-	if !ok {
-		_, err = uc.Create(req.CustomerxID)
+	// A closed wallet is retained with its history, the customer can not get a new one
+	if wallet.Status.String == helper.StatusClosed {
+		return res, errors.New(helper.Closed)
+	}
+	if wallet.ID == "" {
+		_, err = uc.Create(req.CustomerxID, req.ClientID)
 		if err != nil {
 			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Create", uc.ReqID)
 			return res, err
 		}
 	}
 
+	// The client id binds the signed requests of the token to the client which issued it
 	payload := map[string]interface{}{
 		"customerx_id": req.CustomerxID,
+		"client_id":    req.ClientID,
+		"scopes":       scopes,
+	}
+	session := viewmodel.SessionVM{
+		UserAgent: req.UserAgent,
+		IP:        req.IP,
 	}
 	jwtUc := JwtUC{ContractUC: uc.ContractUC}
-	err = jwtUc.GenerateToken(payload, &res)
+	err = jwtUc.GenerateToken(payload, session, &res)
 	if err != nil {
 		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "jwt", uc.ReqID)
 		return res, errors.New(helper.InternalServer)
@@ -50,23 +71,43 @@ func (uc WalletUC) Init(req *request.WalletInitRequest) (res viewmodel.JwtVM, er
 	return res, err
 }
 
-// Enable ...
-func (uc WalletUC) Enable(customerxID string) (res viewmodel.WalletEnableVM, err error) {
-	const (
-		ctx = "WalletUC.Enable"
-	)
+// tokenScopes the requested scopes of the token, each must be granted to the client,
+// without a request the token gets every token scope of the client
+func (uc WalletUC) tokenScopes(requested, clientScopes []string) (res []string, err error) {
+	if len(requested) == 0 {
+		for _, scope := range TokenScopeWhitelist {
+			if str.Contains(clientScopes, scope) {
+				res = append(res, scope)
+			}
+		}
+		if len(res) == 0 {
+			return res, errors.New(helper.InsufficientScope)
+		}
 
-	m := model.NewWalletModel(uc.DB, uc.Tx)
-	status, err := m.FindStatusByOwen(customerxID)
-	if err != nil {
-		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "WalletExist", uc.ReqID)
 		return res, err
 	}
 
-	if status == helper.StatusEnabled && status != "" {
-		return res, errors.New(helper.AlreadyEnabled)
+	for _, scope := range requested {
+		if !str.Contains(TokenScopeWhitelist, scope) {
+			return res, errors.New(helper.InvalidScope)
+		}
+		if !str.Contains(clientScopes, scope) {
+			return res, errors.New(helper.InsufficientScope)
+		}
+		if !str.Contains(res, scope) {
+			res = append(res, scope)
+		}
 	}
 
+	return res, err
+}
+
+// Enable ...
+func (uc WalletUC) Enable(customerxID string) (res viewmodel.WalletEnableVM, err error) {
+	const (
+		ctx = "WalletUC.Enable"
+	)
+
 	data, err := uc.Update(&request.WalletUpdateRequest{CustomerxID: customerxID, Status: helper.StatusEnabled, EnabledAt: time.Now().Format(time.RFC3339)})
 	if err != nil {
 		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Update", uc.ReqID)
@@ -91,17 +132,6 @@ func (uc WalletUC) Disable(customerxID string) (res viewmodel.WalletDisbleVM, er
 		ctx = "WalletUC.Disable"
 	)
 
-	m := model.NewWalletModel(uc.DB, uc.Tx)
-	status, err := m.FindStatusByOwen(customerxID)
-	if err != nil {
-		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "WalletExist", uc.ReqID)
-		return res, err
-	}
-
-	if status == helper.StatusDisabled && status != "" {
-		return res, errors.New(helper.Disabled)
-	}
-
 	data, err := uc.Update(&request.WalletUpdateRequest{CustomerxID: customerxID, Status: helper.StatusDisabled, DisabledAt: time.Now().Format(time.RFC3339)})
 	if err != nil {
 		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Update", uc.ReqID)
@@ -120,25 +150,301 @@ func (uc WalletUC) Disable(customerxID string) (res viewmodel.WalletDisbleVM, er
 	return res, err
 }
 
-// Create ...
-func (uc WalletUC) Create(customerxID string) (res viewmodel.WalletEnableVM, err error) {
+// Freeze block the withdrawals and transfers of the wallet until the freeze expires or is lifted
+// by an operator, until is RFC3339 and empty for no expiry
+func (uc WalletUC) Freeze(customerxID, until string, acceptDeposits bool) (res viewmodel.WalletVM, err error) {
+	const (
+		ctx = "WalletUC.Freeze"
+	)
+
+	if until != "" {
+		untilTime, err := time.Parse(time.RFC3339, until)
+		if err != nil || !untilTime.After(time.Now()) {
+			return res, errors.New(helper.InvalidDate)
+		}
+		until = untilTime.Format(time.RFC3339)
+	}
+
+	res, err = uc.Update(&request.WalletUpdateRequest{
+		CustomerxID:    customerxID,
+		Status:         helper.StatusFrozen,
+		FrozenUntil:    until,
+		AcceptDeposits: acceptDeposits,
+	})
+	if err != nil {
+		logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "Update", uc.ReqID)
+		return res, err
+	}
+
+	return res, err
+}
+
+// Close settle and permanently close the wallet, pending operations must be processed first. A wallet
+// without balance is closed at once. A remaining balance is paid out to the destination with a regular
+// pending withdrawal, the wallet accepts no other operation meanwhile and is closed once the payout
+// succeeds. The closed wallet and its history are retained for the retention period.
+func (uc WalletUC) Close(req *request.WalletCloseRequest) (res viewmodel.WalletCloseVM, err error) {
+	const (
+		ctx = "WalletUC.Close"
+	)
+
+	if req.Destination != "" && !PayoutDestinationRegex.MatchString(req.Destination) {
+		return res, errors.New(helper.InvalidDestination)
+	}
+	if req.Reason != "" {
+		uc.Audit.Reason = req.Reason
+	}
+
+	tx := model.SQLDBTx{DB: uc.DB}
+	txFunc, err := tx.TxBegin()
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "TxBegin", uc.ReqID)
+		return res, err
+	}
+
+	err = txFunc.TxEnd(func() error {
+		// The wallet row lock keeps new operations out until the wallet is closed
+		ownedByIndex := uc.CustomerIndex(req.CustomerxID)
+		m := model.NewWalletModel(uc.DB, txFunc.DB)
+		before, err := m.FindByOwenForUpdate(ownedByIndex)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindByOwenForUpdate", uc.ReqID)
+			return err
+		}
+		if before.ID == "" {
+			return errors.New(helper.WalletNotFound)
+		}
+		err = uc.transition(walletStatus(before), helper.StatusClosed)
+		if err != nil {
+			logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "transition", uc.ReqID)
+			return err
+		}
+
+		balanceModel := model.NewBalanceModel(uc.DB, txFunc.DB)
+		pending, err := balanceModel.PendingExist(ownedByIndex)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "PendingExist", uc.ReqID)
+			return err
+		}
+		if pending {
+			return errors.New(helper.PendingOperations)
+		}
+
+		ledgerUc := LedgerUC{ContractUC: uc.ContractUC, Tx: txFunc.DB}
+		balance, err := ledgerUc.WalletBalance(before.ID)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "WalletBalance", uc.ReqID)
+			return err
+		}
+		if balance == 0 {
+			data, err := uc.settleClose(txFunc.DB, before, uc.Audit.Reason)
+			if err != nil {
+				return err
+			}
+			res.WalletVM = viewmodel.WalletCloseResp{
+				ID:       data.ID,
+				Status:   data.Status.String,
+				ClosedAt: data.ClosedAt.String,
+				Balance:  data.Balance,
+			}
+
+			return uc.recordClose(txFunc.DB, before, data, uc.Audit.Reason)
+		}
+
+		if req.Destination == "" {
+			return errors.New(helper.BalanceNotZero)
+		}
+		if walletStatus(before) == helper.StatusFrozen {
+			return errors.New(helper.Frozen)
+		}
+		// Checked under the wallet lock so a retried close can not pay out twice
+		ok, err := balanceModel.ReferenceExist(req.ReferenceID)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "ReferenceExist", uc.ReqID)
+			return err
+		}
+		if ok {
+			return errors.New(helper.ReferenceExist)
+		}
+
+		payout, err := uc.payout(txFunc.DB, req, balance)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "payout", uc.ReqID)
+			return err
+		}
+		res.Payout = &payout
+		_, err = m.StartClose(ownedByIndex, payout.ID, uc.Audit.Reason)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "StartClose", uc.ReqID)
+			return err
+		}
+		res.WalletVM = viewmodel.WalletCloseResp{
+			ID:      before.ID,
+			Status:  walletStatus(before),
+			Balance: before.Balance,
+		}
+
+		after := walletSnapshot(before)
+		after.ClosingPayoutID = payout.ID
+		after.Operation = &viewmodel.OperationSnapshotVM{
+			ID:          payout.ID,
+			Type:        helper.TypeWithdrawal,
+			Amount:      payout.Amount,
+			ReferenceID: payout.ReferenceID,
+			Status:      payout.Status,
+		}
+		auditUc := AuditUC{ContractUC: uc.ContractUC, Tx: txFunc.DB}
+		return auditUc.Record(uc.Audit, helper.AuditWithdrawalRequest, before.ID, walletSnapshot(before), after)
+	})
+	if err != nil {
+		return res, err
+	}
+	if res.Payout == nil {
+		uc.RevokeSessions(uc.CustomerIndex(req.CustomerxID))
+	}
+
+	res.WalletVM.OwnedBy = req.CustomerxID
+
+	return res, nil
+}
+
+// payout request the withdrawal of the whole balance of a closing wallet to the destination, it is
+// processed by the update balance listener like any other withdrawal
+func (uc WalletUC) payout(tx *sql.Tx, req *request.WalletCloseRequest, amount int) (res viewmodel.WithdrawalResp, err error) {
+	res = viewmodel.WithdrawalResp{
+		Amount:      amount,
+		Status:      helper.StatusPending,
+		ReferenceID: req.ReferenceID,
+		WithdrawnBy: req.CustomerxID,
+		WithdrawnAt: time.Now().Format(time.RFC3339),
+		Destination: req.Destination,
+	}
+
+	// The owner is stored encrypted, the response keeps the plain id
+	stored := res
+	var withdrawnByIndex string
+	stored.WithdrawnBy, withdrawnByIndex, err = uc.EncryptCustomer(model.BalanceWithdrawnBy, req.CustomerxID)
+	if err != nil {
+		return res, err
+	}
+	res.ID, err = model.NewBalanceModel(uc.DB, tx).StoreWd(stored, withdrawnByIndex)
+	if model.IsUniqueViolation(err) {
+		return res, errors.New(helper.ReferenceExist)
+	}
+	if err != nil {
+		return res, err
+	}
+
+	balanceUc := BalanceUC{ContractUC: uc.ContractUC}
+	err = balanceUc.storeQueue(tx, viewmodel.SendQueue{
+		OwnedByIndex: withdrawnByIndex,
+		Amount:       amount,
+		Type:         helper.TypeWithdrawal,
+		BalanceID:    res.ID,
+	})
+
+	return res, err
+}
+
+// settleClose set the closed status of the locked wallet, the balance must be zero
+func (uc WalletUC) settleClose(tx *sql.Tx, before model.WalletEntity, reason string) (data model.WalletEntity, err error) {
+	const (
+		ctx = "WalletUC.settleClose"
+	)
+
+	retentionYears := str.StringToInt(uc.EnvConfig["WALLET_RETENTION_YEARS"])
+	if retentionYears <= 0 {
+		retentionYears = DefaultWalletRetentionYears
+	}
+
+	m := model.NewWalletModel(uc.DB, tx)
+	_, err = m.Close(before.OwnedByIndex, reason, retentionYears)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Close", uc.ReqID)
+		return data, err
+	}
+	data, err = m.FindByOwenForUpdate(before.OwnedByIndex)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindByOwenForUpdate", uc.ReqID)
+		return data, err
+	}
+
+	return data, err
+}
+
+// recordClose record the closure settled by settleClose, last in the transaction
+func (uc WalletUC) recordClose(tx *sql.Tx, before, after model.WalletEntity, reason string) (err error) {
+	audit := uc.Audit
+	audit.Reason = reason
+	auditUc := AuditUC{ContractUC: uc.ContractUC, Tx: tx}
+
+	return auditUc.Record(audit, helper.AuditWalletClose, before.ID, walletSnapshot(before), walletSnapshot(after))
+}
+
+// RevokeSessions end the sessions of a closed wallet. The wallet is closed whatever happens to the
+// sessions, its tokens are rejected on the closed status anyway and removing the refresh ids keeps
+// new tokens from being issued.
+func (uc WalletUC) RevokeSessions(ownedByIndex string) {
+	const (
+		ctx = "WalletUC.RevokeSessions"
+	)
+
+	sessionUc := SessionUC{ContractUC: uc.ContractUC}
+	err := sessionUc.DeleteAllByIndex(ownedByIndex)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "DeleteAllByIndex", uc.ReqID)
+	}
+}
+
+// Create clientID is the api client which created the wallet
+func (uc WalletUC) Create(customerxID, clientID string) (res viewmodel.WalletEnableVM, err error) {
 	const (
 		ctx = "WalletUC.Create"
 	)
 
-	walletData := viewmodel.WalletEnableResp{OwnedBy: customerxID, Balance: 0}
-	res = viewmodel.WalletEnableVM{WalletVM: walletData}
-	m := model.NewWalletModel(uc.DB, uc.Tx)
-	res.WalletVM.ID, err = m.Store(res)
+	ownedBy, ownedByIndex, err := uc.EncryptCustomer(model.WalletOwnedBy, customerxID)
 	if err != nil {
-		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Store", uc.ReqID)
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "EncryptCustomer", uc.ReqID)
 		return res, err
 	}
 
+	// The wallet, its ledger account and its audit event are committed together
+	tx := model.SQLDBTx{DB: uc.DB}
+	txFunc, err := tx.TxBegin()
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "TxBegin", uc.ReqID)
+		return res, err
+	}
+
+	var id string
+	err = txFunc.TxEnd(func() error {
+		walletData := viewmodel.WalletEnableResp{OwnedBy: ownedBy, Balance: 0}
+		m := model.NewWalletModel(uc.DB, txFunc.DB)
+		id, err = m.Store(viewmodel.WalletEnableVM{WalletVM: walletData}, ownedByIndex, clientID)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Store", uc.ReqID)
+			return err
+		}
+		ledgerUc := LedgerUC{ContractUC: uc.ContractUC, Tx: txFunc.DB}
+		_, err = ledgerUc.OpenWalletAccount(id)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "OpenWalletAccount", uc.ReqID)
+			return err
+		}
+
+		auditUc := AuditUC{ContractUC: uc.ContractUC, Tx: txFunc.DB}
+		return auditUc.Record(uc.Audit, helper.AuditWalletCreate, id, nil, viewmodel.WalletSnapshotVM{ID: id})
+	})
+	if err != nil {
+		return res, err
+	}
+	res = viewmodel.WalletEnableVM{WalletVM: viewmodel.WalletEnableResp{ID: id, OwnedBy: customerxID, Balance: 0}}
+
 	return res, err
 }
 
-// Update ...
+// Update move the wallet to the status when the transition is allowed, the change and its audit
+// event are committed together
 func (uc WalletUC) Update(req *request.WalletUpdateRequest) (res viewmodel.WalletVM, err error) {
 	const (
 		ctx = "WalletUC.Update"
@@ -151,16 +457,137 @@ func (uc WalletUC) Update(req *request.WalletUpdateRequest) (res viewmodel.Walle
 		DisabledAt: req.DisabledAt,
 	}
 
-	m := model.NewWalletModel(uc.DB, uc.Tx)
-	res.ID, res.Balance, err = m.Update(res)
+	tx := model.SQLDBTx{DB: uc.DB}
+	txFunc, err := tx.TxBegin()
 	if err != nil {
-		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Update", uc.ReqID)
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "TxBegin", uc.ReqID)
 		return res, err
 	}
 
+	err = txFunc.TxEnd(func() error {
+		ownedByIndex := uc.CustomerIndex(req.CustomerxID)
+		m := model.NewWalletModel(uc.DB, txFunc.DB)
+		before, err := m.FindByOwenForUpdate(ownedByIndex)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindByOwenForUpdate", uc.ReqID)
+			return err
+		}
+		if before.ID == "" {
+			return errors.New(helper.WalletNotFound)
+		}
+		// Only Close moves the wallet to closed, after settling its balance
+		if req.Status == helper.StatusClosed {
+			return errors.New(helper.InvalidTransition)
+		}
+		err = uc.transition(walletStatus(before), req.Status)
+		if err != nil {
+			logruslogger.Log(logruslogger.InfoLevel, err.Error(), ctx, "transition", uc.ReqID)
+			return err
+		}
+
+		if req.Status == helper.StatusFrozen {
+			// A frozen wallet frozen again keeps the status it was first frozen from
+			from := before.Status.String
+			if from == helper.StatusFrozen {
+				from = before.FrozenFrom.String
+			}
+			res.ID, err = m.Freeze(ownedByIndex, model.WalletFreezeEntity{
+				Reason:         uc.Audit.Reason,
+				Until:          req.FrozenUntil,
+				AcceptsDeposit: req.AcceptDeposits,
+				From:           from,
+			})
+			res.Balance = before.Balance
+		} else {
+			res.ID, res.Balance, err = m.Update(ownedByIndex, res)
+		}
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Update", uc.ReqID)
+			return err
+		}
+		after, err := m.FindByOwenForUpdate(ownedByIndex)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindByOwenForUpdate", uc.ReqID)
+			return err
+		}
+
+		auditUc := AuditUC{ContractUC: uc.ContractUC, Tx: txFunc.DB}
+		return auditUc.Record(uc.Audit, helper.AuditWalletStatus, before.ID, walletSnapshot(before), walletSnapshot(after))
+	})
+
 	return res, err
 }
 
+// transition check the wallet can move from its status in force to the status
+func (uc WalletUC) transition(from, to string) error {
+	transitions := WalletCustomerTransitions
+	if uc.Operator {
+		transitions = WalletOperatorTransitions
+	}
+	if str.Contains(transitions[from], to) {
+		return nil
+	}
+
+	switch {
+	case from == to && to == helper.StatusEnabled:
+		return errors.New(helper.AlreadyEnabled)
+	case from == to && to == helper.StatusDisabled:
+		return errors.New(helper.Disabled)
+	case from == helper.StatusClosed:
+		return errors.New(helper.Closed)
+	case from == helper.StatusFrozen:
+		return errors.New(helper.Frozen)
+	}
+
+	return errors.New(helper.InvalidTransition)
+}
+
+// walletStatus the status in force, a freeze past its expiry is over and the wallet is back to
+// the status it was frozen from until its next change
+func walletStatus(d model.WalletEntity) string {
+	if d.Status.String != helper.StatusFrozen || !d.FrozenUntil.Valid {
+		return d.Status.String
+	}
+	until, err := time.Parse(time.RFC3339Nano, d.FrozenUntil.String)
+	if err != nil || time.Now().Before(until) {
+		return helper.StatusFrozen
+	}
+
+	return d.FrozenFrom.String
+}
+
+// walletAccepts whether the wallet accepts a deposit or a withdrawal, a transfer is a withdrawal
+// of the sender and a deposit of the receiver. A closing wallet only waits for its payout.
+func walletAccepts(d model.WalletEntity, operationType string) error {
+	switch walletStatus(d) {
+	case helper.StatusEnabled:
+	case helper.StatusFrozen:
+		if operationType != helper.TypeDeposit || !d.FrozenAcceptsDeposit {
+			return errors.New(helper.Frozen)
+		}
+	case helper.StatusClosed:
+		return errors.New(helper.Closed)
+	default:
+		return errors.New(helper.Disabled)
+	}
+	if d.ClosingPayoutID.Valid {
+		return errors.New(helper.Closing)
+	}
+
+	return nil
+}
+
+// walletPosts whether a pending operation is still posted, checked with the status in force under the
+// wallet lock. The payout of a closing wallet is posted whatever the status it was closed from,
+// unless the wallet was frozen since.
+func walletPosts(d model.WalletEntity, req viewmodel.SendQueue) error {
+	if d.ClosingPayoutID.Valid && d.ClosingPayoutID.String == req.BalanceID && walletStatus(d) != helper.StatusFrozen {
+		return nil
+	}
+
+	return walletAccepts(d, req.Type)
+}
+
 // GetWallet ...
 func (uc WalletUC) GetWallet(customerxID string) (res viewmodel.WalletEnableVM, err error) {
 	const (
@@ -173,7 +600,10 @@ func (uc WalletUC) GetWallet(customerxID string) (res viewmodel.WalletEnableVM,
 		return res, err
 	}
 
-	if res.WalletVM.Status != helper.StatusEnabled {
+	if res.WalletVM.Status == helper.StatusClosed {
+		return res, errors.New(helper.Closed)
+	}
+	if res.WalletVM.Status != helper.StatusEnabled && res.WalletVM.Status != helper.StatusFrozen {
 		return res, errors.New(helper.Disabled)
 	}
 
@@ -186,17 +616,16 @@ func (uc WalletUC) FindByOwen(customerxID string) (res viewmodel.WalletEnableVM,
 		ctx = "WalletUC.FindByOwen"
 	)
 
-	m := model.NewWalletModel(uc.DB, uc.Tx)
-	data, err := m.FindByOwen(customerxID)
+	data, err := uc.findByOwen(customerxID)
 	if err != nil {
-		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindByOwen", uc.ReqID)
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "findByOwen", uc.ReqID)
 		return res, err
 	}
 
 	walletData := viewmodel.WalletEnableResp{
 		ID:        data.ID,
-		OwnedBy:   data.OwnedBy,
-		Status:    data.Status.String,
+		OwnedBy:   uc.DecryptCustomer(model.WalletOwnedBy, data.OwnedBy),
+		Status:    walletStatus(data),
 		Balance:   data.Balance,
 		EnabledAt: data.EnabledAt.String,
 	}
@@ -205,6 +634,38 @@ func (uc WalletUC) FindByOwen(customerxID string) (res viewmodel.WalletEnableVM,
 	return res, err
 }
 
+// findByOwen find the wallet by the blind index of its owner. A wallet stored before field
+// encryption and not migrated yet has no index, it is encrypted on its first lookup so the
+// customer never gets a second wallet.
+func (uc WalletUC) findByOwen(customerxID string) (data model.WalletEntity, err error) {
+	const (
+		ctx = "WalletUC.findByOwen"
+	)
+
+	m := model.NewWalletModel(uc.DB, uc.Tx)
+	data, err = m.FindByOwen(uc.CustomerIndex(customerxID))
+	if err != nil || data.ID != "" {
+		return data, err
+	}
+
+	owner, ownedByIndex, err := uc.EncryptCustomer(model.WalletOwnedBy, customerxID)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "EncryptCustomer", uc.ReqID)
+		return data, err
+	}
+	id, err := m.AdoptLegacyOwner(strings.ToLower(customerxID), owner, ownedByIndex)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "AdoptLegacyOwner", uc.ReqID)
+		return data, err
+	}
+	if id != "" {
+		logruslogger.Log(logruslogger.InfoLevel, id, ctx, "adopted", uc.ReqID)
+	}
+
+	// Read again, the wallet may also have been migrated by a concurrent caller
+	return m.FindByOwen(ownedByIndex)
+}
+
 // CheckBalance ...
 func (uc WalletUC) CheckBalance(customerxID string, amount int) (ok bool, err error) {
 	const (
@@ -212,7 +673,7 @@ func (uc WalletUC) CheckBalance(customerxID string, amount int) (ok bool, err er
 	)
 
 	m := model.NewWalletModel(uc.DB, uc.Tx)
-	balance, err := m.FindBalanceByOwen(customerxID)
+	balance, err := m.FindBalanceByOwen(uc.CustomerIndex(customerxID))
 	if err != nil {
 		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindBalanceByOwen", uc.ReqID)
 		return ok, err
@@ -226,33 +687,199 @@ func (uc WalletUC) CheckBalance(customerxID string, amount int) (ok bool, err er
 	return true, err
 }
 
-// AddBalance ...
-func (uc WalletUC) AddBalance(req viewmodel.SendQueue) (err error) {
+// AddBalance post the balance operation to the ledger and refresh the wallet cached balance, closed
+// reports the wallet was closed with its payout so its sessions are revoked once the caller committed
+func (uc WalletUC) AddBalance(req viewmodel.SendQueue) (closed bool, err error) {
 	const (
 		ctx = "WalletUC.AddBalance"
 	)
 
+	// A message redelivered after the commit finds the row already processed and is skipped
+	balanceUc := BalanceUC{ContractUC: uc.ContractUC, Tx: uc.Tx}
+	if uc.Tx != nil {
+		status, err := model.NewBalanceModel(uc.DB, uc.Tx).FindStatusForUpdate(req.BalanceID)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindStatusForUpdate", uc.ReqID)
+			return closed, err
+		}
+		if status == "" {
+			return closed, errors.New(helper.BalanceNotFound)
+		}
+		if status != helper.StatusPending {
+			logruslogger.Log(logruslogger.InfoLevel, req.BalanceID+" "+status, ctx, "already_processed", uc.ReqID)
+			return closed, nil
+		}
+	}
+
+	// Lock the wallet row so concurrent operations on the same wallet are serialized
 	m := model.NewWalletModel(uc.DB, uc.Tx)
+	var wallet model.WalletEntity
+	if uc.Tx != nil {
+		wallet, err = m.FindByOwenForUpdate(uc.OwnerIndex(req))
+	} else {
+		wallet, err = m.FindByOwen(uc.OwnerIndex(req))
+	}
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindByOwen", uc.ReqID)
+		return closed, err
+	}
+	if wallet.ID == "" {
+		logruslogger.Log(logruslogger.ErrorLevel, req.BalanceID, ctx, "not_found", uc.ReqID)
+		return closed, errors.New(helper.WalletNotFound)
+	}
+
+	// The wallet may have been disabled, frozen or closed since the operation was requested
+	if err := walletPosts(wallet, req); err != nil {
+		logruslogger.Log(logruslogger.InfoLevel, req.BalanceID+" "+err.Error(), ctx, "not_accepted", uc.ReqID)
+		return closed, uc.failBalance(balanceUc, wallet, req, err.Error())
+	}
+
+	ledgerUc := LedgerUC{ContractUC: uc.ContractUC, Tx: uc.Tx}
 	if req.Type == helper.TypeWithdrawal {
-		_, err = m.MinusBalance(req.OwnedBy, req.Amount)
+		balance, err := ledgerUc.WalletBalance(wallet.ID)
 		if err != nil {
-			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "MinusBalance", uc.ReqID)
-			return err
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "WalletBalance", uc.ReqID)
+			return closed, err
 		}
-	} else if req.Type == helper.TypeDeposit {
-		_, err = m.PlusBalance(req.OwnedBy, req.Amount)
-		if err != nil {
-			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "PlusBalance", uc.ReqID)
-			return err
+
+		// Funds were checked when the withdrawal was requested, but another
+		// operation may have been applied since, so the row is failed instead
+		if req.Amount > balance {
+			logruslogger.Log(logruslogger.InfoLevel, req.BalanceID, ctx, "insufficient_balance", uc.ReqID)
+			return closed, uc.failBalance(balanceUc, wallet, req, helper.InsufficientBalance)
 		}
 	}
 
-	balanceUc := BalanceUC{ContractUC: uc.ContractUC}
+	_, err = ledgerUc.PostBalance(wallet.ID, req)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "PostBalance", uc.ReqID)
+		return closed, err
+	}
+
+	balance, err := ledgerUc.WalletBalance(wallet.ID)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "WalletBalance", uc.ReqID)
+		return closed, err
+	}
+
+	_, err = m.UpdateBalance(wallet.OwnedByIndex, balance)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "UpdateBalance", uc.ReqID)
+		return closed, err
+	}
+
 	err = balanceUc.UpdateStatus(req.BalanceID, helper.StatusSuccess)
 	if err != nil {
 		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "UpdateStatus", uc.ReqID)
+		return closed, err
+	}
+
+	// Only a transactional run can append to the audit chain
+	if uc.Tx == nil {
+		return closed, err
+	}
+	posted := wallet
+	posted.Balance = balance
+
+	// The payout of a closing wallet is posted, the wallet is closed with it
+	closing := wallet.ClosingPayoutID.String == req.BalanceID
+	var settled model.WalletEntity
+	if closing {
+		settled, err = uc.settleClose(uc.Tx, posted, wallet.ClosingReason.String)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "settleClose", uc.ReqID)
+			return closed, err
+		}
+	}
+
+	// The events record the wallet before and after the operation
+	after := walletSnapshot(posted)
+	after.Operation = &viewmodel.OperationSnapshotVM{
+		ID:     req.BalanceID,
+		Type:   req.Type,
+		Amount: req.Amount,
+		Status: helper.StatusSuccess,
+	}
+	auditUc := AuditUC{ContractUC: uc.ContractUC, Tx: uc.Tx}
+	err = auditUc.Record(uc.Audit, helper.AuditBalancePosted, wallet.ID, walletSnapshot(wallet), after)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "Record", uc.ReqID)
+		return closed, err
+	}
+	if closing {
+		err = uc.recordClose(uc.Tx, posted, settled, wallet.ClosingReason.String)
+		if err != nil {
+			logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "recordClose", uc.ReqID)
+			return closed, err
+		}
+		closed = true
+	}
+
+	return closed, err
+}
+
+// FailBalance fail a pending balance operation which could not be posted, a failed payout cancels the closure
+func (uc WalletUC) FailBalance(req viewmodel.SendQueue, reason string) (err error) {
+	const (
+		ctx = "WalletUC.FailBalance"
+	)
+
+	// A row processed meanwhile keeps its outcome
+	status, err := model.NewBalanceModel(uc.DB, uc.Tx).FindStatusForUpdate(req.BalanceID)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindStatusForUpdate", uc.ReqID)
+		return err
+	}
+	if status == "" {
+		return errors.New(helper.BalanceNotFound)
+	}
+	if status != helper.StatusPending {
+		logruslogger.Log(logruslogger.InfoLevel, req.BalanceID+" "+status, ctx, "already_processed", uc.ReqID)
+		return nil
+	}
+
+	wallet, err := model.NewWalletModel(uc.DB, uc.Tx).FindByOwenForUpdate(uc.OwnerIndex(req))
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "FindByOwenForUpdate", uc.ReqID)
+		return err
+	}
+	if wallet.ID == "" {
+		logruslogger.Log(logruslogger.ErrorLevel, req.BalanceID, ctx, "not_found", uc.ReqID)
+		return errors.New(helper.WalletNotFound)
+	}
+
+	balanceUc := BalanceUC{ContractUC: uc.ContractUC, Tx: uc.Tx}
+	err = uc.failBalance(balanceUc, wallet, req, reason)
+	if err != nil {
+		logruslogger.Log(logruslogger.ErrorLevel, err.Error(), ctx, "failBalance", uc.ReqID)
 		return err
 	}
 
 	return err
 }
+
+// failBalance fail the balance operation instead of posting it, a failed payout cancels the closure
+func (uc WalletUC) failBalance(balanceUc BalanceUC, wallet model.WalletEntity, req viewmodel.SendQueue, reason string) (err error) {
+	err = balanceUc.UpdateFailure(req.BalanceID, helper.StatusFailed, reason)
+	if err != nil || uc.Tx == nil {
+		return err
+	}
+	if wallet.ClosingPayoutID.String == req.BalanceID {
+		_, err = model.NewWalletModel(uc.DB, uc.Tx).CancelClose(wallet.OwnedByIndex)
+		if err != nil {
+			return err
+		}
+	}
+
+	after := walletSnapshot(wallet)
+	after.Operation = &viewmodel.OperationSnapshotVM{
+		ID:     req.BalanceID,
+		Type:   req.Type,
+		Amount: req.Amount,
+		Status: helper.StatusFailed,
+		Reason: reason,
+	}
+	auditUc := AuditUC{ContractUC: uc.ContractUC, Tx: uc.Tx}
+
+	return auditUc.Record(uc.Audit, helper.AuditBalanceFailed, wallet.ID, walletSnapshot(wallet), after)
+}